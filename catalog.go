@@ -0,0 +1,113 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"payshop3/api"
+	"strings"
+	"time"
+)
+
+const catalog_usage string = "usage: payshop3 catalog diff old.json new.json"
+
+// runCatalog handles the catalog subcommands
+func runCatalog(args []string) error {
+	if len(args) != 3 || args[0] != "diff" {
+		return errors.New(catalog_usage)
+	}
+	older, older_at, err := api.ReadCatalogSnapshot(args[1])
+	if err != nil {
+		return err
+	}
+	newer, newer_at, err := api.ReadCatalogSnapshot(args[2])
+	if err != nil {
+		return err
+	}
+	if !older_at.IsZero() && !newer_at.IsZero() {
+		fmt.Printf("Catalog of %s compared to %s\n\n", newer_at.Local().Format(time.DateTime), older_at.Local().Format(time.DateTime))
+	}
+	fmt.Print(catalogDiffReport(api.DiffCatalogs(older, newer), false))
+	return nil
+}
+
+// catalogDiffReport renders d as text, with tview color tags when color is set
+func catalogDiffReport(d api.CatalogDiff, color bool) string {
+	if d.Empty() {
+		return "Nothing changed\n"
+	}
+	tag := func(c string) string {
+		if !color {
+			return ""
+		}
+		return "[" + c + "]"
+	}
+	var sb strings.Builder
+	section := func(title string, n int) {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s%s (%d)%s\n", tag("yellow"), title, n, tag("-"))
+	}
+
+	if len(d.Added) > 0 {
+		section("New items", len(d.Added))
+		for _, v := range d.Added {
+			fmt.Fprintf(&sb, "%s+ %s%s\n", tag("green"), itemLabel(v), tag("-"))
+		}
+	}
+	if len(d.Removed) > 0 {
+		section("Removed items", len(d.Removed))
+		for _, v := range d.Removed {
+			fmt.Fprintf(&sb, "%s- %s%s\n", tag("red"), itemLabel(v), tag("-"))
+		}
+	}
+	if len(d.Prices) > 0 {
+		section("Price changes", len(d.Prices))
+		for _, p := range d.Prices {
+			region := p.Region
+			if region == "" {
+				region = "-"
+			}
+			fmt.Fprintf(&sb, "  %s (%s, %s): %s -> %s\n", p.Sku, region, p.Currency,
+				priceLabel(p.OldPrice, p.OldDiscounted), priceLabel(p.NewPrice, p.NewDiscounted))
+		}
+	}
+	if len(d.Status) > 0 {
+		section("Status changes", len(d.Status))
+		for _, s := range d.Status {
+			fmt.Fprintf(&sb, "  %s %s: %s -> %s\n", s.Sku, s.Field, s.Old, s.New)
+		}
+	}
+	return sb.String()
+}
+
+func itemLabel(item api.ShopItemData) string {
+	sku, name := "", ""
+	if item.Sku != nil {
+		sku = *item.Sku
+	}
+	if item.Name != nil {
+		name = *item.Name
+	} else if item.Title != nil {
+		name = *item.Title
+	}
+	if name == "" || name == sku {
+		return sku
+	}
+	return fmt.Sprintf("%s (%s)", sku, name)
+}
+
+func priceLabel(price int, discounted int) string {
+	if price == 0 && discounted == 0 {
+		return "not sold"
+	}
+	if discounted == 0 || discounted == price {
+		return formatNumberSpaced(price)
+	}
+	return fmt.Sprintf("%s (%s discounted)", formatNumberSpaced(price), formatNumberSpaced(discounted))
+}
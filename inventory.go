@@ -0,0 +1,200 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"payshop3/api"
+	"payshop3/ui"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+var (
+	inventory_kinds = []string{"All", api.InventoryPreplanning, api.InventoryCoins, api.InventoryOther}
+	inventory_sorts = []string{"Name", "Uses left", "Quantity", "Last granted"}
+)
+
+// inventoryGroup is a heading of the inventory table: a kind, and the heist for preplanning assets
+type inventoryGroup struct {
+	title string
+	items []api.InventoryItem
+}
+
+// filterInventory keeps the items of the kind ("All" for any) whose name, heist or SKU contains text
+func filterInventory(inv []api.InventoryItem, kind string, text string) []api.InventoryItem {
+	text = strings.ToLower(strings.TrimSpace(text))
+	ret := []api.InventoryItem{}
+	for _, v := range inv {
+		if kind != "All" && v.Kind != kind {
+			continue
+		}
+		if text != "" && !strings.Contains(strings.ToLower(v.PrettyName+" "+v.PrettyHeistName+" "+v.Sku), text) {
+			continue
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// sortInventory orders the items by one of inventory_sorts; counts and dates go largest first
+func sortInventory(inv []api.InventoryItem, by string) {
+	sort.SliceStable(inv, func(i, j int) bool {
+		a, b := inv[i], inv[j]
+		switch by {
+		case "Uses left":
+			if a.UseCount != b.UseCount {
+				return a.UseCount > b.UseCount
+			}
+		case "Quantity":
+			if a.Quantity != b.Quantity {
+				return a.Quantity > b.Quantity
+			}
+		case "Last granted":
+			if !a.GrantedAt.Equal(b.GrantedAt) {
+				return a.GrantedAt.After(b.GrantedAt)
+			}
+		}
+		return strings.ToLower(a.PrettyName) < strings.ToLower(b.PrettyName)
+	})
+}
+
+// groupInventory splits sorted items into preplanning assets per heist, then C-Stacks, then the rest
+func groupInventory(inv []api.InventoryItem) []inventoryGroup {
+	heists := map[string]int{}
+	groups := []inventoryGroup{}
+	coins := inventoryGroup{title: api.InventoryCoins}
+	other := inventoryGroup{title: api.InventoryOther}
+	for _, v := range inv {
+		switch v.Kind {
+		case api.InventoryPreplanning:
+			g, ok := heists[v.PrettyHeistName]
+			if !ok {
+				g = len(groups)
+				heists[v.PrettyHeistName] = g
+				groups = append(groups, inventoryGroup{title: fmt.Sprintf("%s - %s", api.InventoryPreplanning, v.PrettyHeistName)})
+			}
+			groups[g].items = append(groups[g].items, v)
+		case api.InventoryCoins:
+			coins.items = append(coins.items, v)
+		default:
+			other.items = append(other.items, v)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].title < groups[j].title
+	})
+	for _, g := range []inventoryGroup{coins, other} {
+		if len(g.items) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// showInventory opens the inventory page and loads what the user owns in the background
+func showInventory() {
+	inv := []api.InventoryItem{}
+	kind, sort_by, search := inventory_kinds[0], inventory_sorts[0], ""
+
+	status := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	inv_table := tview.NewTable().SetBorders(true).SetFixed(1, 0)
+	render := func() {
+		inv_table.Clear()
+		for c, v := range []string{"Name", "SKU", "Uses left", "Qty", "Last granted", "In shop"} {
+			inv_table.SetCell(0, c, tview.NewTableCell(v).SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+		}
+		shown := filterInventory(inv, kind, search)
+		sortInventory(shown, sort_by)
+		row := 1
+		for _, g := range groupInventory(shown) {
+			inv_table.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%s (%d)", g.title, len(g.items))).SetTextColor(tcell.ColorOrange).SetSelectable(false))
+			row++
+			for _, v := range g.items {
+				granted, in_shop := "-", "no"
+				if !v.GrantedAt.IsZero() {
+					granted = v.GrantedAt.Local().Format("2006-01-02 15:04")
+				}
+				if v.InCatalog {
+					in_shop = "yes"
+				}
+				inv_table.SetCell(row, 0, tview.NewTableCell("  "+v.PrettyName).SetAlign(tview.AlignLeft))
+				inv_table.SetCell(row, 1, tview.NewTableCell(v.Sku).SetAlign(tview.AlignLeft).SetTextColor(tcell.ColorGray))
+				inv_table.SetCell(row, 2, tview.NewTableCell(formatNumberSpaced(v.UseCount)).SetAlign(tview.AlignRight))
+				inv_table.SetCell(row, 3, tview.NewTableCell(formatNumberSpaced(v.Quantity)).SetAlign(tview.AlignRight))
+				inv_table.SetCell(row, 4, tview.NewTableCell(granted).SetAlign(tview.AlignLeft))
+				inv_table.SetCell(row, 5, tview.NewTableCell(in_shop).SetAlign(tview.AlignCenter))
+				row++
+			}
+		}
+		if len(inv) > 0 {
+			status.SetText(fmt.Sprintf("%d of %d owned item(s) shown", len(shown), len(inv)))
+		}
+	}
+	load := func() {
+		status.SetText("Loading inventory...")
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			got, err := client.Inventory(ctx)
+			app.QueueUpdateDraw(func() {
+				if err != nil {
+					status.SetText(fmt.Sprintf("Error: %s", err.Error()))
+					return
+				}
+				inv = ui.PrettifyInventory(got)
+				render()
+				if len(inv) == 0 {
+					status.SetText("You do not own anything from the shop yet")
+				}
+			})
+		}()
+	}
+
+	filter_form := tview.NewForm().SetHorizontal(true).
+		AddDropDown("Show", inventory_kinds, 0, func(option string, optionIndex int) {
+			kind = option
+			render()
+		}).
+		AddInputField("Search", "", 25, nil, func(text string) {
+			search = text
+			render()
+		}).
+		AddDropDown("Sort by", inventory_sorts, 0, func(option string, optionIndex int) {
+			sort_by = option
+			render()
+		}).
+		AddButton("Refresh", load).
+		AddButton("Back", func() {
+			pages.SwitchToPage("entry")
+			app.SetFocus(main_menu_list)
+		})
+
+	inventory_page := tview.NewGrid().
+		SetRows(1, 3, 0, 1).
+		SetBorders(true).
+		AddItem(newPrimitive("Inventory"), 0, 0, 1, 1, 0, 0, false).
+		AddItem(filter_form, 1, 0, 1, 1, 0, 0, true).
+		AddItem(inv_table, 2, 0, 1, 1, 0, 0, false).
+		AddItem(status, 3, 0, 1, 1, 0, 0, false)
+	inv_table.SetSelectable(true, false).SetDoneFunc(func(key tcell.Key) {
+		app.SetFocus(filter_form)
+	})
+	filter_form.SetCancelFunc(func() {
+		pages.SwitchToPage("entry")
+		app.SetFocus(main_menu_list)
+	})
+
+	render()
+	pages.AddAndSwitchToPage("inventory", inventory_page, true)
+	app.SetFocus(filter_form)
+	load()
+}
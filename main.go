@@ -6,8 +6,9 @@ Copyright (C) 2023  AlexDash
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"math"
 	"os"
@@ -16,6 +17,8 @@ import (
 	"payshop3/util"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -23,6 +26,7 @@ import (
 )
 
 var (
+	client          *api.Client
 	loginScreen     *tview.Grid
 	loginForm       *tview.Form
 	entryPage       *tview.Grid
@@ -31,14 +35,21 @@ var (
 	pages           *tview.Pages
 	UI_header_info  *tview.Grid
 	cart_section    *tview.Grid
+	cart_table      *tview.Table
 	basicOrderData  api.BasicOrderData
 	exOrderData     api.ExclusiveOrderData
 	goldOrderData   api.GoldOrderData
 	credOrderData   api.CreditOrderData
 	Cart            []api.OrderInitData
 	checkout        func()
-	OrderInProgress bool
+	OrderInProgress atomic.Bool
+	stopOrder       context.CancelFunc
 	B_VER           = "v0.8.5-ALPHA"
+	login_notice    = "Logged out.\nPlease log in with your Nebula account first"
+	// in the order of the api.Remember modes
+	remember_options = []string{"No", "Session only (no password)", "Login and password"}
+	// currency choice of the order forms that leaves it to api.Client.ResolvePrice
+	auto_currency = "Auto"
 )
 
 func main() {
@@ -46,27 +57,100 @@ func main() {
 	// sc := make(chan os.Signal, 1)
 	// signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
 
-	login_raw, err := os.ReadFile("payshop3_logindata.json")
-	if err == nil {
-		ta := tview.NewApplication()
-		p := newPrimitive("Logging you in, please wait...")
-		go func() {
-			if err := ta.SetRoot(p, true).Run(); err != nil {
-				panic(err)
-			}
-		}()
+	if len(os.Args) > 1 && os.Args[1] == "mock-server" {
+		if err := runMockServer(os.Args[2:]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "catalog" {
+		if err := runCatalog(os.Args[2:]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	base_url := flag.String("base-url", api.DefaultBaseURL, "Nebula base URL")
+	profile := flag.String("profile", "", "name of the saved profile to use")
+	flag.Parse()
+
+	settings = loadSettings()
+	app_log = openLog()
+	client = api.NewClient(
+		api.WithBaseURL(*base_url),
+		api.WithRateLimit(settings.RateLimit),
+		api.WithCatalogCache(api.CatalogCacheFile, 0),
+		api.WithLogger(app_log),
+	)
+
+	migrateLegacyLogin()
+	startProfile = *profile
+	if startProfile == "" {
+		startProfile = settings.LastProfile
+	}
+	if startProfile == "" {
+		startProfile = default_profile
+	}
+	if err := checkProfileName(startProfile); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
 
-		var d api.LoginData
-		err = json.Unmarshal(login_raw, &d)
-		if err == nil {
-			api.Init(d.Login, d.Password, d.AutoLogin)
+	if hasSavedLogin(startProfile) {
+		// the passphrase has to be known before api.Init can save refreshed tokens
+		d, store, ok := unlockSavedLogin(startProfile)
+		if ok {
+			client.SetSessionStore(store)
+			var (
+				ae *api.AuthError
+				ne *api.NetworkError
+				uo *api.UnknownOutcomeError
+			)
+			err := autoLogin(d)
+			if err == nil {
+				openProfile(startProfile)
+			} else if errors.As(err, &ae) {
+				login_notice = "Your saved session has expired.\nPlease log in again"
+			} else if errors.As(err, &ne) || errors.As(err, &uo) {
+				login_notice = "Nebula could not be reached.\nTry again, or browse the cached catalog offline"
+			}
 		}
-		ta.Stop()
 	}
 	setupUI()
+	saveCart()
 
 	// <-sc
-	fmt.Println("\n=======================\nQuitting PayShop3...\n=======================\n")
+	fmt.Print("\n=======================\nQuitting PayShop3...\n=======================\n\n")
+}
+
+// autoLogin signs in with a saved session behind a splash screen
+func autoLogin(d api.LoginData) error {
+	ta := tview.NewApplication()
+	p := tview.NewTextView().SetTextAlign(tview.AlignCenter).SetText("Logging you in, please wait...")
+	go func() {
+		if err := ta.SetRoot(p, true).Run(); err != nil {
+			panic(err)
+		}
+	}()
+
+	ctx := api.WithCatalogProgress(context.Background(), func(loaded int, total int) {
+		ta.QueueUpdateDraw(func() {
+			p.SetText(shopProgressText(loaded, total))
+		})
+	})
+	err := client.Resume(ctx, d)
+	ta.Stop()
+	return err
+}
+
+// shopProgressText describes a catalog download for the status lines
+func shopProgressText(loaded int, total int) string {
+	if total > 0 {
+		return fmt.Sprintf("Loading shop data... %d/%d items", loaded, total)
+	}
+	return fmt.Sprintf("Loading shop data... %d items", loaded)
 }
 
 func onlyNumbers(s string, r rune) bool {
@@ -98,6 +182,42 @@ func genericModal(text string) {
 	app.SetRoot(modal, true).SetFocus(modal)
 }
 
+// logoutModal asks whether to log out of the current profile only or of every saved one
+func logoutModal() {
+	modal := tview.NewModal().
+		SetText("Log out of this account?\n\nEverywhere also deletes the saved logins of all profiles").
+		AddButtons([]string{"Log out", "Everywhere", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			app.SetRoot(pages, true).SetFocus(pages)
+			if buttonLabel != "Log out" && buttonLabel != "Everywhere" {
+				return
+			}
+			name := activeProfile
+			closeProfile()
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			defer cancel()
+			var err error
+			if buttonLabel == "Everywhere" {
+				files := []string{}
+				for _, p := range listProfiles() {
+					if hasSavedLogin(p) {
+						files = append(files, profilePath(p, api.LoginFile))
+					}
+				}
+				err = client.LogoutEverywhere(ctx, files)
+			} else {
+				err = client.Logout(ctx)
+			}
+			refreshProfilePicker(name)
+			pages.SwitchToPage("login")
+			if err != nil {
+				// the local session is gone either way
+				genericModal(fmt.Sprintf("You are logged out, but not everything could be cleaned up:\n%s", err.Error()))
+			}
+		})
+	app.SetRoot(modal, true).SetFocus(modal)
+}
+
 func browserModal(resp api.OrderRespData) {
 	dec := *resp.Currency.Decimals
 	curr := *resp.Currency.CurrencyCode
@@ -129,33 +249,244 @@ func updateHeaderUI() {
 	}
 	logout := tview.NewButton("Log out").
 		SetSelectedFunc(func() {
-			api.Logout()
+			if OrderInProgress.Load() {
+				genericModal("Stop the current order before logging out")
+				return
+			}
+			logoutModal()
+		})
+	switch_acc := tview.NewButton("Switch account").
+		SetSelectedFunc(func() {
+			if OrderInProgress.Load() {
+				genericModal("Stop the current order before switching accounts")
+				return
+			}
+			name := activeProfile
+			closeProfile()
+			// the saved login stays, so the profile can be picked again with its passphrase
+			client.Disconnect()
+			refreshProfilePicker(name)
 			pages.SwitchToPage("login")
 		})
 
-	cash, err1 := api.GetCachedWalletByCode("CASH")
-	gold, err2 := api.GetCachedWalletByCode("GOLD")
-	cred, err3 := api.GetCachedWalletByCode("CRED")
+	go_online := tview.NewButton("Go online").
+		SetSelectedFunc(func() {
+			name := activeProfile
+			closeProfile()
+			refreshProfilePicker(name)
+			pages.SwitchToPage("login")
+		})
 
-	if api.LD.DisplayName != "" && err1 == nil && err2 == nil && err3 == nil {
-		UI_header_info = tview.NewGrid().SetRows(1).SetColumns(0, 40, 10).
+	cash, err1 := client.GetCachedWalletByCode("CASH")
+	gold, err2 := client.GetCachedWalletByCode("GOLD")
+	cred, err3 := client.GetCachedWalletByCode("CRED")
+
+	info := client.CatalogInfo()
+	header_cols := 4
+	if info.Offline {
+		header_cols = 3
+		UI_header_info = tview.NewGrid().SetRows(1).SetColumns(0, 40, 26).
+			AddItem(newPrimitive("Wallets are not available offline"), 0, 0, 1, 1, 0, 0, false).
+			AddItem(newPrimitive(fmt.Sprintf("OFFLINE [%s]", activeProfile)), 0, 1, 1, 1, 0, 0, false).
+			AddItem(go_online, 0, 2, 1, 1, 0, 0, false)
+	} else if client.Session().DisplayName != "" && err1 == nil && err2 == nil && err3 == nil {
+		UI_header_info = tview.NewGrid().SetRows(1).SetColumns(0, 40, 16, 10).
 			AddItem(newPrimitive(fmt.Sprintf("Cash: $%s | C-Stacks: %s | Credits: %s",
 				formatNumberSpaced(*cash.Balance),
 				formatNumberSpaced(*gold.Balance),
 				formatNumberSpaced(*cred.Balance))), 0, 0, 1, 1, 0, 0, false).
-			AddItem(newPrimitive(fmt.Sprintf("LOGGED IN AS: %s", api.LD.DisplayName)), 0, 1, 1, 1, 0, 0, false).
-			AddItem(logout, 0, 2, 1, 1, 0, 0, false)
+			AddItem(newPrimitive(fmt.Sprintf("LOGGED IN AS: %s [%s]", client.Session().DisplayName, activeProfile)), 0, 1, 1, 1, 0, 0, false).
+			AddItem(switch_acc, 0, 2, 1, 1, 0, 0, false).
+			AddItem(logout, 0, 3, 1, 1, 0, 0, false)
 	} else {
-		UI_header_info = tview.NewGrid().SetRows(1).SetColumns(0, 40, 10).
+		UI_header_info = tview.NewGrid().SetRows(1).SetColumns(0, 40, 16, 10).
 			AddItem(newPrimitive("Cash: $999 999 999 999 | C-Stacks:99 999 | Credits: 999 999"), 0, 0, 1, 1, 0, 0, false).
 			AddItem(newPrimitive("Logged in as: USERNAME_USERNAME"), 0, 1, 1, 1, 0, 0, false).
-			AddItem(logout, 0, 2, 1, 1, 0, 0, false)
+			AddItem(switch_acc, 0, 2, 1, 1, 0, 0, false).
+			AddItem(logout, 0, 3, 1, 1, 0, 0, false)
 	}
 
+	catalog_text, catalog_color := catalogStatusText(info)
+	UI_header_info.SetRows(1, 1).
+		AddItem(tview.NewTextView().SetTextAlign(tview.AlignCenter).SetTextColor(catalog_color).SetText(catalog_text), 1, 0, 1, header_cols, 0, 0, false)
+
 	entryPage.AddItem(UI_header_info, 0, 0, 1, 3, 0, 0, false)
 	time.AfterFunc(time.Second*2, func() { app.Draw() })
 }
 
+// catalogStatusText tells how far the catalog on screen can be trusted
+func catalogStatusText(info api.CatalogInfo) (string, tcell.Color) {
+	fetched := info.FetchedAt.Local().Format("2006-01-02 15:04")
+	switch {
+	case info.FetchedAt.IsZero():
+		return "", tcell.ColorGray
+	case info.Offline:
+		return fmt.Sprintf("OFFLINE - showing the catalog cached on %s. Ordering is disabled", fetched), tcell.ColorRed
+	case info.Stale && info.Refreshing:
+		return fmt.Sprintf("Catalog from %s may be outdated, refreshing...", fetched), tcell.ColorOrange
+	case info.Stale:
+		return fmt.Sprintf("Catalog from %s may be outdated, prices can differ at checkout", fetched), tcell.ColorOrange
+	case info.Rejected > 0:
+		return fmt.Sprintf("Catalog updated %s, %d unusable item(s) hidden (see %s)", fetched, info.Rejected, log_file), tcell.ColorGray
+	case info.Region != "":
+		return fmt.Sprintf("Catalog updated %s, prices for region %s", fetched, info.Region), tcell.ColorGray
+	}
+	return fmt.Sprintf("Catalog updated %s", fetched), tcell.ColorGray
+}
+
+// attemptLabel decorates a checkout status mark with the attempt count once a request was retried
+func attemptLabel(mark string, attempts int) string {
+	if attempts <= 1 {
+		return fmt.Sprintf(" %s ", mark)
+	}
+	return fmt.Sprintf(" %s x%d ", mark, attempts)
+}
+
+// describeOrderError maps an api error to a checkout status mark and a short reason for the summary
+func describeOrderError(err error) (string, string) {
+	var (
+		balance *api.InsufficientBalanceError
+		unavail *api.ItemUnavailableError
+		price   *api.PriceMismatchError
+		limit   *api.LimitExceededError
+		rate    *api.RateLimitError
+		auth    *api.AuthError
+		srv     *api.ServerError
+		unknown *api.UnknownOutcomeError
+		netw    *api.NetworkError
+	)
+	switch {
+	case errors.As(err, &balance):
+		return "$", "insufficient balance"
+	case errors.As(err, &unavail):
+		return "X", "item unavailable"
+	case errors.As(err, &price):
+		return "X", "price changed"
+	case errors.As(err, &limit):
+		return "X", "purchase limit reached"
+	case errors.As(err, &rate):
+		return "X", "rate limited"
+	case errors.As(err, &auth):
+		return "X", "session expired"
+	case errors.As(err, &unknown):
+		return "?", "outcome unknown, check My Orders"
+	case errors.As(err, &srv):
+		return "X", "server error"
+	case errors.As(err, &netw):
+		return "X", "network error"
+	}
+	return "X", "order rejected"
+}
+
+// orderStatus is the status of an order, or UNKNOWN when Nebula did not send one
+func orderStatus(od api.OrderRespData) string {
+	if od.Status == nil {
+		return "UNKNOWN"
+	}
+	return *od.Status
+}
+
+// orderStatusCell marks a placed order in the checkout table: fulfilled, still
+// going (with its status) or settled without being fulfilled
+func orderStatusCell(od api.OrderRespData, attempts int) *tview.TableCell {
+	status := orderStatus(od)
+	switch {
+	case status == "FULFILLED":
+		return tview.NewTableCell(attemptLabel("✓", attempts)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignCenter)
+	case !api.OrderSettled(status):
+		return tview.NewTableCell(attemptLabel("! "+status, attempts)).SetTextColor(tcell.ColorDarkOrange).SetAlign(tview.AlignCenter)
+	}
+	return tview.NewTableCell(attemptLabel("X "+status, attempts)).SetTextColor(tcell.ColorRed).SetAlign(tview.AlignCenter)
+}
+
+// settledSummary lists the final states of the orders that were not fulfilled
+// right away, and the states the ones no longer followed were still in
+func settledSummary(settled []string, unsettled []string) string {
+	ret := ""
+	if len(settled) > 0 {
+		ret += fmt.Sprintf("\n\n%d order(s) were not fulfilled right away, they ended up:\n%s", len(settled), strings.Join(countLines(settled), "\n"))
+	}
+	if len(unsettled) > 0 {
+		still := []string{}
+		for _, v := range unsettled {
+			still = append(still, "still "+v)
+		}
+		ret += fmt.Sprintf("\n\n%d order(s) stopped being followed before they settled, check My Orders later:\n%s", len(unsettled), strings.Join(countLines(still), "\n"))
+	}
+	return ret
+}
+
+// failureSummary lists how many cart lines failed for each reason
+func failureSummary(reasons []string) string {
+	if len(reasons) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\n%d line(s) failed:\n%s", len(reasons), strings.Join(countLines(reasons), "\n"))
+}
+
+// countLines turns repeated values into "N x value" lines, in the order they first appear
+func countLines(values []string) []string {
+	counts := map[string]int{}
+	order := []string{}
+	for _, v := range values {
+		if counts[v] == 0 {
+			order = append(order, v)
+		}
+		counts[v]++
+	}
+	lines := []string{}
+	for _, v := range order {
+		lines = append(lines, fmt.Sprintf("%d x %s", counts[v], v))
+	}
+	return lines
+}
+
+// currencyOptions lists the currencies the items are sold for, after the automatic choice
+func currencyOptions(items []api.Item) []string {
+	opts := []string{auto_currency}
+	seen := map[string]bool{}
+	for _, it := range items {
+		for _, c := range it.Currencies() {
+			if !seen[c] {
+				seen[c] = true
+				opts = append(opts, c)
+			}
+		}
+	}
+	return opts
+}
+
+// currencyDropDown adds the currency picker of an order form; picked keeps the choice
+func currencyDropDown(form *tview.Form, items []api.Item, picked *string) {
+	opts := currencyOptions(items)
+	idx := 0
+	for i, o := range opts {
+		if o == *picked {
+			idx = i
+		}
+	}
+	*picked = opts[idx]
+	form.AddDropDown("Currency", opts, idx, func(option string, optionIndex int) {
+		*picked = option
+	})
+}
+
+// linePrice resolves the price of an item in the currency picked on an order form
+func linePrice(it api.Item, picked string) (api.Price, error) {
+	if picked == auto_currency {
+		picked = ""
+	}
+	return client.ResolvePrice(it, picked)
+}
+
+// lineCurrency shows the currency of a cart line with the region it is priced for
+func lineCurrency(cc string, region string) string {
+	if region == "" {
+		return cc
+	}
+	return fmt.Sprintf("%s (%s)", cc, region)
+}
+
 func newPrimitive(text string) tview.Primitive {
 	return tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
@@ -163,7 +494,7 @@ func newPrimitive(text string) tview.Primitive {
 }
 
 func addBasicCacheToCart() error {
-	if OrderInProgress {
+	if OrderInProgress.Load() {
 		return nil
 	}
 	if basicOrderData.ItemTypeID == 0 {
@@ -178,14 +509,14 @@ func addBasicCacheToCart() error {
 	}
 
 	// data is valid, proceed
-	rawCache := api.GetAssetBank()
+	rawCache := client.GetAssetBank()
 	assetCache := ui.PrettifyBasic(&rawCache)
-	var itemRef []api.ShopItemData
+	var itemRef []api.Item
 
 	for _, sel1 := range *assetCache {
-		if sel1.Sku == "uni" {
-			for _, v := range sel1.Bank {
-				if strings.Contains(strings.ToLower(*v.Name), strings.ToLower(basicOrderData.ItemType)) || (basicOrderData.ItemTypeID == 5) {
+		if sel1.Sku == api.SkuUniversalGroup {
+			for _, v := range sel1.Items {
+				if strings.Contains(strings.ToLower(v.Name), strings.ToLower(basicOrderData.ItemType)) || (basicOrderData.ItemTypeID == 5) {
 					itemRef = append(itemRef, v)
 				}
 			}
@@ -196,6 +527,14 @@ func addBasicCacheToCart() error {
 	}
 
 	// item ref valid, proceed
+	prices := make([]api.Price, len(itemRef))
+	for i, lref := range itemRef {
+		p, err := linePrice(lref, basicOrderData.Currency)
+		if err != nil {
+			return err
+		}
+		prices[i] = p
+	}
 
 	var count int
 	switch basicOrderData.BuyTypeID {
@@ -203,9 +542,8 @@ func addBasicCacheToCart() error {
 		count = basicOrderData.Amount
 	case 2:
 		bundle_discount_price := 0
-		for _, lref := range itemRef {
-			rd := *lref.RegionData
-			bundle_discount_price += *rd[0].DiscountedPrice
+		for _, p := range prices {
+			bundle_discount_price += p.DiscountedPrice
 		}
 		if bundle_discount_price == 0 {
 			count = 1
@@ -217,35 +555,23 @@ func addBasicCacheToCart() error {
 		return errors.New("failed to guess buy order type")
 	}
 
-	for _, lref := range itemRef {
+	for i, lref := range itemRef {
 		if count == 0 {
 			// do not add 0 quantity items
 			continue
 		}
-		rd := *lref.RegionData
-		orderObj := api.OrderInitData{
-			ItemId:          *lref.ItemId,
-			Quantity:        count,
-			Price:           *rd[0].Price * count,
-			DiscountedPrice: *rd[0].DiscountedPrice * count,
-			CurrencyCode:    *rd[0].CurrencyCode,
-			Region:          *lref.Region,
-			Language:        *lref.Language,
-			PrettyName:      *lref.PrettyName,
-			PrettyHeistName: *lref.PrettyHeistName,
-			ReturnUrl:       "http://127.0.0.1",
-		}
-		Cart = append(Cart, orderObj)
+		Cart = append(Cart, lref.Order(prices[i], count))
 	}
 
 	//order cached in cart, update UI
+	_, dropped := limitCart()
 	updateCartUI()
 
-	return nil
+	return limitError(dropped)
 }
 
 func addExclusiveCacheToCart() error {
-	if OrderInProgress {
+	if OrderInProgress.Load() {
 		return nil
 	}
 	if exOrderData.BuyTypeID == 0 {
@@ -264,20 +590,20 @@ func addExclusiveCacheToCart() error {
 		return errors.New("asset selection is incorrect")
 	}
 
-	rawCache := api.GetAssetBank()
+	rawCache := client.GetAssetBank()
 	assetCache := ui.PrettifyBasic(&rawCache)
-	var itemRef []api.ShopItemData
+	var itemRef []api.Item
 
 	g_sku := ui.HeistSelector[exOrderData.HeistTypeID][0]
 
 	for _, sel1 := range *assetCache {
-		if (sel1.Sku == g_sku || exOrderData.HeistType == "EVERYTHING") && sel1.Sku != "uni" {
-			for _, v := range sel1.Bank {
+		if (sel1.Sku == g_sku || exOrderData.HeistType == "EVERYTHING") && sel1.Sku != api.SkuUniversalGroup {
+			for _, v := range sel1.Items {
 				if exOrderData.HeistType == "EVERYTHING" {
 					itemRef = append(itemRef, v)
 					continue
 				}
-				if *v.Sku == exOrderData.ItemTypeSKU || (exOrderData.ItemType == "EVERYTHING") {
+				if v.Sku == exOrderData.ItemTypeSKU || (exOrderData.ItemType == "EVERYTHING") {
 					itemRef = append(itemRef, v)
 				}
 			}
@@ -288,6 +614,14 @@ func addExclusiveCacheToCart() error {
 	}
 
 	// item ref valid, proceed
+	prices := make([]api.Price, len(itemRef))
+	for i, lref := range itemRef {
+		p, err := linePrice(lref, exOrderData.Currency)
+		if err != nil {
+			return err
+		}
+		prices[i] = p
+	}
 
 	var count int
 	switch exOrderData.BuyTypeID {
@@ -295,9 +629,8 @@ func addExclusiveCacheToCart() error {
 		count = exOrderData.Amount
 	case 2:
 		bundle_discount_price := 0
-		for _, lref := range itemRef {
-			rd := *lref.RegionData
-			bundle_discount_price += *rd[0].DiscountedPrice
+		for _, p := range prices {
+			bundle_discount_price += p.DiscountedPrice
 		}
 		if bundle_discount_price == 0 {
 			count = 1
@@ -309,35 +642,36 @@ func addExclusiveCacheToCart() error {
 		return errors.New("failed to guess buy order type")
 	}
 
-	for _, lref := range itemRef {
+	for i, lref := range itemRef {
 		if count == 0 {
 			// do not add 0 quantity items
 			continue
 		}
-		rd := *lref.RegionData
-		orderObj := api.OrderInitData{
-			ItemId:          *lref.ItemId,
-			Quantity:        count,
-			Price:           *rd[0].Price * count,
-			DiscountedPrice: *rd[0].DiscountedPrice * count,
-			CurrencyCode:    *rd[0].CurrencyCode,
-			Region:          *lref.Region,
-			Language:        *lref.Language,
-			PrettyName:      *lref.PrettyName,
-			PrettyHeistName: *lref.PrettyHeistName,
-			ReturnUrl:       "http://127.0.0.1",
-		}
-		Cart = append(Cart, orderObj)
+		Cart = append(Cart, lref.Order(prices[i], count))
 	}
 
 	//order cached in cart, update UI
+	_, dropped := limitCart()
 	updateCartUI()
 
-	return nil
+	return limitError(dropped)
+}
+
+// gold_skus are the C-Stack bundles, largest first
+var gold_skus = []string{"pd3_coin_goldlarge0", "pd3_coin_goldmedium0", "pd3_coin_goldsmall0"}
+
+func goldItems() []api.Item {
+	items := []api.Item{}
+	for _, sku := range gold_skus {
+		if g, err := client.GetItemBySKU(sku); err == nil {
+			items = append(items, g)
+		}
+	}
+	return items
 }
 
 func addGoldCacheToCart() error {
-	if OrderInProgress {
+	if OrderInProgress.Load() {
 		return nil
 	}
 	if goldOrderData.BuyTypeID == 0 {
@@ -348,17 +682,17 @@ func addGoldCacheToCart() error {
 		return errors.New("cannot buy 0 C-Stacks")
 	}
 
-	g1, err := api.GetItemBySKU("pd3_coin_goldsmall0")
+	g1, err := client.GetItemBySKU("pd3_coin_goldsmall0")
 	if err != nil {
 		return errors.New("could not find 1 C-Stack bundle in the shop")
 	}
 
-	g5, err := api.GetItemBySKU("pd3_coin_goldmedium0")
+	g5, err := client.GetItemBySKU("pd3_coin_goldmedium0")
 	if err != nil {
 		return errors.New("could not find 5 C-Stack bundle in the shop")
 	}
 
-	g10, err := api.GetItemBySKU("pd3_coin_goldlarge0")
+	g10, err := client.GetItemBySKU("pd3_coin_goldlarge0")
 	if err != nil {
 		return errors.New("could not find 10 C-Stack bundle in the shop")
 	}
@@ -366,67 +700,60 @@ func addGoldCacheToCart() error {
 	switch goldOrderData.BuyTypeID {
 	case 1:
 		// by coin amount
-		for _, g := range []api.ShopItemData{g10, g5, g1} {
-			count := presum / *g.UseCount
+		for _, g := range []api.Item{g10, g5, g1} {
+			count := presum / g.UseCount
 			if count == 0 {
 				continue
 			}
-			rd := *g.RegionData
-			Cart = append(Cart, api.OrderInitData{
-				ItemId:          *g.ItemId,
-				Quantity:        count,
-				Price:           *rd[0].Price * count,
-				DiscountedPrice: *rd[0].DiscountedPrice * count,
-				CurrencyCode:    *rd[0].CurrencyCode,
-				Region:          *g.Region,
-				Language:        *g.Language,
-				ReturnUrl:       "http://127.0.0.1/",
-				PrettyName:      ui.PrettyNamesBySKU[*g.Sku],
-				PrettyHeistName: "Universal",
-			})
-			presum = presum - (*g.UseCount * count)
+			p, err := linePrice(g, goldOrderData.Currency)
+			if err != nil {
+				return err
+			}
+			g.PrettyName = ui.PrettyNamesBySKU[g.Sku]
+			g.PrettyHeistName = "Universal"
+			Cart = append(Cart, g.Order(p, count))
+			presum = presum - (g.UseCount * count)
 		}
 	case 2:
 		// by wallet amount
-		for _, g := range []api.ShopItemData{g10, g5, g1} {
-			rd := *g.RegionData
-			count := presum / *rd[0].DiscountedPrice
+		for _, g := range []api.Item{g10, g5, g1} {
+			p, err := linePrice(g, goldOrderData.Currency)
+			if err != nil {
+				return err
+			}
+			price := p.DiscountedPrice
+			if price == 0 {
+				continue
+			}
+			count := presum / price
 			if count == 0 {
 				continue
 			}
-			Cart = append(Cart, api.OrderInitData{
-				ItemId:          *g.ItemId,
-				Quantity:        count,
-				Price:           *rd[0].Price * count,
-				DiscountedPrice: *rd[0].DiscountedPrice * count,
-				CurrencyCode:    *rd[0].CurrencyCode,
-				Region:          *g.Region,
-				Language:        *g.Language,
-				ReturnUrl:       "http://127.0.0.1/",
-				PrettyName:      ui.PrettyNamesBySKU[*g.Sku],
-				PrettyHeistName: "Universal",
-			})
-			presum = presum - (*rd[0].DiscountedPrice * count)
+			g.PrettyName = ui.PrettyNamesBySKU[g.Sku]
+			g.PrettyHeistName = "Universal"
+			Cart = append(Cart, g.Order(p, count))
+			presum = presum - (price * count)
 		}
 
 	default:
 		return errors.New("unacceptable order type")
 	}
+	_, dropped := limitCart()
 	updateCartUI()
 
-	return nil
+	return limitError(dropped)
 }
 
-func orderCredits(credit_shop_items []api.ShopItemData, form *tview.Form) (api.OrderRespData, error) {
+func orderCredits(credit_shop_items []api.Item, form *tview.Form) (api.OrderRespData, error) {
 	b := form.GetButton(form.GetButtonIndex("Order directly"))
 	if b == nil {
 		return api.OrderRespData{}, errors.New("failed to find ui button")
 	}
 	b.SetDisabled(true)
 	f := false
-	var item api.ShopItemData
+	var item api.Item
 	for _, item = range credit_shop_items {
-		if *item.Name == credOrderData.ItemType {
+		if item.Name == credOrderData.ItemType {
 			f = true
 			break
 		}
@@ -435,18 +762,16 @@ func orderCredits(credit_shop_items []api.ShopItemData, form *tview.Form) (api.O
 		b.SetDisabled(false)
 		return api.OrderRespData{}, errors.New("could not find item in the shop")
 	}
-	rd := *item.RegionData
-	oid := api.OrderInitData{
-		ItemId:          *item.ItemId,
-		Quantity:        credOrderData.Amount,
-		Price:           *rd[0].Price * credOrderData.Amount,
-		DiscountedPrice: *rd[0].DiscountedPrice * credOrderData.Amount,
-		CurrencyCode:    *rd[0].CurrencyCode,
-		Region:          *item.Region,
-		Language:        *item.Language,
-		ReturnUrl:       "http://127.0.0.1",
-	}
-	resp, err := api.ExecOrder(oid)
+	p, err := linePrice(item, credOrderData.Currency)
+	if err != nil {
+		b.SetDisabled(false)
+		return api.OrderRespData{}, err
+	}
+	oid := item.Order(p, credOrderData.Amount)
+	// room for the retries of a slow payment station, without hanging the form
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	resp, err := client.ExecOrder(ctx, oid)
 	if resp.PaymentStationUrl != nil && err == nil {
 		// link present
 		b.SetDisabled(false)
@@ -460,17 +785,149 @@ func orderCredits(credit_shop_items []api.ShopItemData, form *tview.Form) (api.O
 }
 
 func headerTimedUpdate() {
-	api.UpdateWallets()
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	client.UpdateWallets(ctx)
+	cancel()
+	if client.LoggedIn() && client.CatalogInfo().Stale {
+		client.RefreshShopInBackground(func(err error) {
+			app.QueueUpdateDraw(updateHeaderUI)
+		})
+	}
 	updateHeaderUI()
 	time.AfterFunc(time.Minute, headerTimedUpdate)
 }
 
+// discountLabel tells how much a cart line is discounted and for how long
+func discountLabel(line api.OrderInitData, now time.Time) string {
+	if line.DiscountedPrice >= line.Price || line.Price == 0 {
+		return ""
+	}
+	pct := 100 - line.DiscountedPrice*100/line.Price
+	if line.DiscountExpireAt.IsZero() {
+		return fmt.Sprintf("-%d%%", pct)
+	}
+	left := line.DiscountExpireAt.Sub(now)
+	if left <= 0 {
+		return fmt.Sprintf("-%d%%, ending", pct)
+	}
+	return fmt.Sprintf("-%d%%, ends in %s", pct, formatCountdown(left))
+}
+
+func formatCountdown(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd %dh", d/(24*time.Hour), (d%(24*time.Hour))/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %02dm", d/time.Hour, (d%time.Hour)/time.Minute)
+	}
+	return fmt.Sprintf("%dm %02ds", d/time.Minute, (d%time.Minute)/time.Second)
+}
+
+// limitCart caps the cart lines to the purchase limits of their items, counting
+// what the user owns and the earlier lines for the same item. Trimmed lines get
+// a note for the cart table; lines with nothing left are removed and named in
+// the returned list, next to the count of lines that changed at all.
+func limitCart() (int, []string) {
+	inCart := map[string]int{}
+	lines := []api.OrderInitData{}
+	dropped := []string{}
+	changed := 0
+	for _, v := range Cart {
+		it, err := client.LookupItemByIdLocal(v.ItemId)
+		if err != nil {
+			lines = append(lines, v)
+			continue
+		}
+		lim := client.LimitFor(it, inCart[v.ItemId])
+		if lim.Left < 0 || v.Quantity <= lim.Left {
+			inCart[v.ItemId] += v.Quantity
+			lines = append(lines, v)
+			continue
+		}
+		changed++
+		if lim.Left == 0 {
+			dropped = append(dropped, fmt.Sprintf("%s (%s)", v.PrettyName, lim.Reason))
+			continue
+		}
+		v.Price = v.Price / v.Quantity * lim.Left
+		v.DiscountedPrice = v.DiscountedPrice / v.Quantity * lim.Left
+		v.LimitNote = fmt.Sprintf("%d asked, %s", v.Quantity, lim.Reason)
+		v.Quantity = lim.Left
+		inCart[v.ItemId] += v.Quantity
+		lines = append(lines, v)
+	}
+	Cart = lines
+	return changed, dropped
+}
+
+// limitError tells about the lines limitCart removed
+func limitError(dropped []string) error {
+	if len(dropped) == 0 {
+		return nil
+	}
+	return fmt.Errorf("purchase limit reached, not added:\n%s", strings.Join(dropped, "\n"))
+}
+
+// repriceCart brings every cart line to the current price of its item and
+// returns how many lines changed. A line whose item cannot be priced any more
+// keeps its price, but loses a discount that has ended.
+func repriceCart() int {
+	now := client.ServerNow()
+	changed := 0
+	for i, line := range Cart {
+		nl, err := client.Reprice(line)
+		if err != nil {
+			if line.DiscountExpireAt.IsZero() || now.Before(line.DiscountExpireAt) {
+				continue
+			}
+			nl = line
+			nl.DiscountedPrice = nl.Price
+			nl.DiscountExpireAt = time.Time{}
+		}
+		if nl.Price != line.Price || nl.DiscountedPrice != line.DiscountedPrice {
+			changed++
+		}
+		Cart[i] = nl
+	}
+	return changed
+}
+
+// cartTimedUpdate ticks the discount countdowns and re-prices the cart once a discount ends
+func cartTimedUpdate() {
+	app.QueueUpdateDraw(func() {
+		if OrderInProgress.Load() || cart_table == nil {
+			return
+		}
+		now := client.ServerNow()
+		ended := false
+		for i, v := range Cart {
+			if !v.DiscountExpireAt.IsZero() && !now.Before(v.DiscountExpireAt) {
+				ended = true
+			}
+			if cell := cart_table.GetCell(i+1, 6); cell != nil {
+				cell.SetText(discountLabel(v, now))
+			}
+		}
+		if ended {
+			n := repriceCart()
+			updateCartUI()
+			if n > 0 {
+				genericModal(fmt.Sprintf("A discount has ended.\n%d cart line(s) now cost the full price", n))
+			}
+		}
+	})
+	time.AfterFunc(time.Second, cartTimedUpdate)
+}
+
 func updateCartUI() {
 	if cart_section != nil {
 		entryPage.RemoveItem(cart_section)
 	}
-	cart_table := tview.NewTable().SetBorders(true)
-	for c, v := range []string{"#", "Name", "Price", "Qty", "Subtotal", "Currency", "DEL"} {
+	// every change of the cart ends up here
+	saveCart()
+	cart_table = tview.NewTable().SetBorders(true)
+	for c, v := range []string{"#", "Name", "Price", "Qty", "Subtotal", "Currency (Region)", "Discount", "Limit", "DEL"} {
 		cart_table.SetCell(0, c, tview.NewTableCell(v).SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorYellow))
 	}
 
@@ -480,6 +937,7 @@ func updateCartUI() {
 	}
 
 	totalmap := make(map[string][]int)
+	now := client.ServerNow()
 
 	for i, v := range Cart {
 		cc := v.CurrencyCode
@@ -491,8 +949,10 @@ func updateCartUI() {
 		cart_table.SetCell(i+1, 2, tview.NewTableCell(formatNumberSpaced(v.Price/v.Quantity)).SetAlign(tview.AlignLeft))
 		cart_table.SetCell(i+1, 3, tview.NewTableCell(formatNumberSpaced(v.Quantity)).SetAlign(tview.AlignLeft))
 		cart_table.SetCell(i+1, 4, tview.NewTableCell(formatNumberSpaced(v.Price)).SetAlign(tview.AlignLeft))
-		cart_table.SetCell(i+1, 5, tview.NewTableCell(cc).SetAlign(tview.AlignLeft))
-		cart_table.SetCell(i+1, 6, tview.NewTableCell(" |X| ").SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorRed))
+		cart_table.SetCell(i+1, 5, tview.NewTableCell(lineCurrency(cc, v.Region)).SetAlign(tview.AlignLeft))
+		cart_table.SetCell(i+1, 6, tview.NewTableCell(discountLabel(v, now)).SetAlign(tview.AlignLeft).SetTextColor(tcell.ColorGreen))
+		cart_table.SetCell(i+1, 7, tview.NewTableCell(v.LimitNote).SetAlign(tview.AlignLeft).SetTextColor(tcell.ColorOrange))
+		cart_table.SetCell(i+1, 8, tview.NewTableCell(" |X| ").SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorRed))
 		cart_table.SetSelectionChangedFunc(func(row, column int) {
 			if column == cart_table.GetColumnCount()-1 && row > 0 {
 				ct := []api.OrderInitData{}
@@ -550,38 +1010,192 @@ func updateCartUI() {
 func setupUI() {
 	app = tview.NewApplication()
 	pages = tview.NewPages()
+	// useStore picks where the new session of a profile is saved
+	useStore := func(name string, remember api.Remember, passphrase string) error {
+		if err := prepareProfile(name); err != nil {
+			return err
+		}
+		path := profilePath(name, api.LoginFile)
+		if remember == api.RememberNothing {
+			// nothing gets saved, logging in only drops a login saved earlier for this profile
+			client.SetSessionStore(api.NewEncryptedFileStore(path, ""))
+			return nil
+		}
+		if passphrase == "" {
+			return errors.New("choose a passphrase to encrypt your saved info")
+		}
+		client.SetSessionStore(api.NewEncryptedFileStore(path, passphrase))
+		return nil
+	}
+	// enterShop leaves the login screen for the shop of the profile that just logged in
+	enterShop := func(name string) {
+		openProfile(name)
+		updateCartUI()
+		pages.SwitchToPage("entry")
+		// clear data
+		loginForm.GetFormItemByLabel("Status").(*tview.TextView).SetText("Logged out.\nPlease log in with your Nebula account first")
+		loginForm.GetFormItemByLabel("New profile").(*tview.InputField).SetText("")
+		loginForm.GetFormItemByLabel("Login").(*tview.InputField).SetText("")
+		loginForm.GetFormItemByLabel("Password").(*tview.InputField).SetText("")
+		loginForm.GetFormItemByLabel("Remember me").(*tview.DropDown).SetCurrentOption(0)
+		loginForm.GetFormItemByLabel("Passphrase").(*tview.InputField).SetText("")
+		updateHeaderUI()
+	}
+	var cancelBrowserLogin context.CancelFunc
+	loggingIn := false
+
 	loginForm = tview.NewForm().
-		AddTextView("Status", "Logged out.\nPlease log in with your Nebula account first", 50, 2, true, false).
+		AddTextView("Status", login_notice, 50, 2, true, false).
+		AddDropDown("Profile", []string{new_profile_opt}, 0, nil).
+		AddInputField("New profile", "", 50, nil, nil).
 		AddInputField("Login", "", 50, nil, func(text string) {}).
 		AddPasswordField("Password", "", 50, '*', nil).
-		AddCheckbox("Save my info", false, nil).
+		AddDropDown("Remember me", remember_options, 0, nil).
+		AddPasswordField("Passphrase", "", 50, '*', nil).
 		AddButton("Login", func() {
-			loginForm.GetFormItemByLabel("Status").(*tview.TextView).SetText("Logging in...")
+			status := loginForm.GetFormItemByLabel("Status").(*tview.TextView)
+			if loggingIn {
+				return
+			}
+			name, err := pickedProfile()
+			if err != nil {
+				status.SetText("Error: " + err.Error())
+				return
+			}
 			login := loginForm.GetFormItemByLabel("Login").(*tview.InputField).GetText()
 			password := loginForm.GetFormItemByLabel("Password").(*tview.InputField).GetText()
-			save := loginForm.GetFormItemByLabel("Save my info").(*tview.Checkbox).IsChecked()
-			err := api.Init(login, password, save)
+			remember_idx, _ := loginForm.GetFormItemByLabel("Remember me").(*tview.DropDown).GetCurrentOption()
+			remember := api.Remember(remember_idx)
+			passphrase := loginForm.GetFormItemByLabel("Passphrase").(*tview.InputField).GetText()
+			path := profilePath(name, api.LoginFile)
+
+			// resume the saved session of the profile when no credentials were typed in
+			resume := login == "" && password == "" && hasSavedLogin(name)
+			if resume && passphrase == "" {
+				status.SetText("Error: enter the passphrase of the saved login of " + name)
+				return
+			}
+			if !resume {
+				if err := useStore(name, remember, passphrase); err != nil {
+					status.SetText("Error: " + err.Error())
+					return
+				}
+			}
+
+			loggingIn = true
+			status.SetText("Logging in...")
+			ctx := api.WithCatalogProgress(context.Background(), func(loaded int, total int) {
+				app.QueueUpdateDraw(func() {
+					status.SetText(shopProgressText(loaded, total))
+				})
+			})
+			// off the UI thread, so the progress can be drawn
+			go func() {
+				var err error
+				if resume {
+					var store *api.EncryptedFileStore
+					var d api.LoginData
+					store, d, err = openSavedLogin(path, passphrase)
+					if err == nil {
+						client.SetSessionStore(store)
+						err = client.Resume(ctx, d)
+					}
+				} else {
+					err = client.Init(ctx, login, password, remember)
+				}
+				app.QueueUpdateDraw(func() {
+					loggingIn = false
+					var mfa *api.MFARequiredError
+					if errors.As(err, &mfa) {
+						status.SetText("Waiting for the second factor...")
+						mfaPrompt(mfa, func() {
+							enterShop(name)
+						})
+						return
+					}
+					if err != nil {
+						status.SetText("Error: " + err.Error())
+						return
+					}
+					enterShop(name)
+				})
+			}()
+		}).
+		AddButton("Login in browser", func() {
+			status := loginForm.GetFormItemByLabel("Status").(*tview.TextView)
+			if cancelBrowserLogin != nil {
+				// a second press gives up on the pending browser login
+				cancelBrowserLogin()
+				cancelBrowserLogin = nil
+				status.SetText("Browser login cancelled")
+				return
+			}
+			name, err := pickedProfile()
 			if err != nil {
-				loginForm.GetFormItemByLabel("Status").(*tview.TextView).SetText("Error: " + err.Error())
+				status.SetText("Error: " + err.Error())
+				return
+			}
+			remember_idx, _ := loginForm.GetFormItemByLabel("Remember me").(*tview.DropDown).GetCurrentOption()
+			remember := api.Remember(remember_idx)
+			passphrase := loginForm.GetFormItemByLabel("Passphrase").(*tview.InputField).GetText()
+			if err := useStore(name, remember, passphrase); err != nil {
+				status.SetText("Error: " + err.Error())
 				return
 			}
-			loginForm.GetFormItemByLabel("Status").(*tview.TextView).SetText("Loading shop data...")
-			err = api.UpdateShop()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancelBrowserLogin = cancel
+			ctx = api.WithCatalogProgress(ctx, func(loaded int, total int) {
+				app.QueueUpdateDraw(func() {
+					status.SetText(shopProgressText(loaded, total))
+				})
+			})
+			status.SetText("Opening the browser...")
+			go func() {
+				err := client.LoginWithBrowser(ctx, func(url string) error {
+					app.QueueUpdateDraw(func() {
+						status.SetText("Finish logging in in your browser.\nPress the button again to cancel")
+					})
+					return util.OpenBrowser(url)
+				}, remember)
+				cancelled := ctx.Err() == context.Canceled
+				cancel()
+				app.QueueUpdateDraw(func() {
+					if cancelled {
+						return
+					}
+					cancelBrowserLogin = nil
+					if err != nil {
+						status.SetText("Error: " + err.Error())
+						return
+					}
+					enterShop(name)
+				})
+			}()
+		}).
+		AddButton("Browse offline", func() {
+			status := loginForm.GetFormItemByLabel("Status").(*tview.TextView)
+			name, err := pickedProfile()
 			if err != nil {
-				loginForm.GetFormItemByLabel("Status").(*tview.TextView).SetText("Error: Could not load shop data. Cannot proceed.")
+				status.SetText("Error: " + err.Error())
+				return
+			}
+			if err := prepareProfile(name); err != nil {
+				status.SetText("Error: " + err.Error())
+				return
+			}
+			if _, err := client.BrowseOffline(); err != nil {
+				status.SetText("Error: " + err.Error())
 				return
 			}
-			pages.SwitchToPage("entry")
-			// clear data
-			loginForm.GetFormItemByLabel("Status").(*tview.TextView).SetText("Logged out.\nPlease log in with your Nebula account first")
-			loginForm.GetFormItemByLabel("Login").(*tview.InputField).SetText("")
-			loginForm.GetFormItemByLabel("Password").(*tview.InputField).SetText("")
-			loginForm.GetFormItemByLabel("Save my info").(*tview.Checkbox).SetChecked(false)
-			updateHeaderUI()
+			enterShop(name)
 		}).
 		AddButton("Quit", func() {
+			if cancelBrowserLogin != nil {
+				cancelBrowserLogin()
+			}
 			app.Stop()
 		}).SetButtonsAlign(tview.AlignCenter)
+	refreshProfilePicker(startProfile)
 	loginScreen = tview.NewGrid().SetColumns(0, 80, 0).SetRows(0, 80, 0).AddItem(loginForm, 1, 1, 1, 1, 0, 0, false)
 
 	// menu := newPrimitive("Menu")
@@ -619,6 +1233,7 @@ func setupUI() {
 					genericModal(fmt.Sprintf("Error: %s", err.Error()))
 				}
 			})
+		currencyDropDown(order_form, client.GetExclusiveAssetGroupBySku(api.SkuUniversalGroup).Items, &basicOrderData.Currency)
 		order_form.SetBorder(true).SetTitle("Order configuration").SetTitleAlign(tview.AlignCenter)
 		entryPage.RemoveItem(order_config_basic).AddItem(order_form, 1, 1, 1, 1, 0, 100, false)
 		app.SetFocus(order_form)
@@ -655,14 +1270,14 @@ func setupUI() {
 					group_sku := ui.HeistSelector[exOrderData.HeistTypeID][0]
 
 					// asset bank
-					ab_raw := []api.AssetGroupData{api.GetExclusiveAssetGroupBySku(group_sku)}
+					ab_raw := []api.AssetGroupData{client.GetExclusiveAssetGroupBySku(group_sku)}
 					ab := (*ui.PrettifyBasic(&ab_raw))[0]
 					i_sku_map := make(map[string]string)
-					for _, asset := range ab.Bank {
-						sel2 = append(sel2, *asset.PrettyName)
-						i_sku_map[*asset.PrettyName] = *asset.Sku
+					for _, asset := range ab.Items {
+						sel2 = append(sel2, asset.PrettyName)
+						i_sku_map[asset.PrettyName] = asset.Sku
 					}
-					if len(ab.Bank) > 0 {
+					if len(ab.Items) > 0 {
 						sel2 = append(sel2, "EVERYTHING")
 					}
 
@@ -698,6 +1313,7 @@ func setupUI() {
 					genericModal(fmt.Sprintf("Error: %s", err.Error()))
 				}
 			})
+		currencyDropDown(order_form, client.GetExclusivePreplanningAssets(), &exOrderData.Currency)
 		order_form.SetBorder(true).SetTitle("Order configuration").SetTitleAlign(tview.AlignCenter)
 		entryPage.RemoveItem(order_config_basic).AddItem(order_form, 1, 1, 1, 1, 0, 100, false)
 		app.SetFocus(order_form)
@@ -729,17 +1345,31 @@ func setupUI() {
 					genericModal(fmt.Sprintf("Error: %s", err.Error()))
 				}
 			})
+		currencyDropDown(order_form, goldItems(), &goldOrderData.Currency)
 		order_form.SetBorder(true).SetTitle("Order configuration").SetTitleAlign(tview.AlignCenter)
 		entryPage.RemoveItem(order_config_basic).AddItem(order_form, 1, 1, 1, 1, 0, 100, false)
 		app.SetFocus(order_form)
 	}
 
 	checkout = func() {
+		// a line may have gone over a limit since it was added, e.g. after an order in the game
+		if changed, dropped := limitCart(); changed > 0 {
+			updateCartUI()
+			msg := "Purchase limits trimmed the cart, check it before ordering"
+			if err := limitError(dropped); err != nil {
+				msg += "\n\n" + err.Error()
+			}
+			genericModal(msg)
+			return
+		}
 		if cart_section != nil {
 			entryPage.RemoveItem(cart_section)
 		}
+		// order at the prices of now, not of when the lines were added
+		repriceCart()
+		saveCart()
 		checkout_table := tview.NewTable().SetBorders(true)
-		for c, v := range []string{"#", "Name", "Price", "Qty", "Subtotal", "Currency", "Status"} {
+		for c, v := range []string{"#", "Name", "Price", "Qty", "Subtotal", "Currency (Region)", "Status"} {
 			checkout_table.SetCell(0, c, tview.NewTableCell(v).SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorYellow))
 		}
 
@@ -760,7 +1390,7 @@ func setupUI() {
 			checkout_table.SetCell(i+1, 2, tview.NewTableCell(formatNumberSpaced(v.Price/v.Quantity)).SetAlign(tview.AlignLeft))
 			checkout_table.SetCell(i+1, 3, tview.NewTableCell(formatNumberSpaced(v.Quantity)).SetAlign(tview.AlignLeft))
 			checkout_table.SetCell(i+1, 4, tview.NewTableCell(formatNumberSpaced(v.Price)).SetAlign(tview.AlignLeft))
-			checkout_table.SetCell(i+1, 5, tview.NewTableCell(cc).SetAlign(tview.AlignLeft))
+			checkout_table.SetCell(i+1, 5, tview.NewTableCell(lineCurrency(cc, v.Region)).SetAlign(tview.AlignLeft))
 			checkout_table.SetCell(i+1, 6, tview.NewTableCell(" - ").SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorRed)).SetSelectable(true, false)
 			if len(totalmap[cc]) != 0 {
 				// key exists. Update values
@@ -781,8 +1411,9 @@ func setupUI() {
 			offset++
 		}
 
+		order_title := tview.NewTextView().SetTextAlign(tview.AlignCenter).SetText("Your Order")
 		order_top := tview.NewGrid().SetColumns(0, 10).
-			AddItem(newPrimitive("Your Order"), 0, 0, 1, 1, 0, 0, false)
+			AddItem(order_title, 0, 0, 1, 1, 0, 0, false)
 
 		var (
 			back_btn *tview.Button
@@ -791,75 +1422,156 @@ func setupUI() {
 		)
 
 		back_btn = tview.NewButton("Back To Cart").SetSelectedFunc(func() {
-			if OrderInProgress {
+			if OrderInProgress.Load() {
 				return
 			}
 			updateCartUI()
 		})
 		stop_btn = tview.NewButton("Stop Order").SetSelectedFunc(func() {
-			if !OrderInProgress {
+			if !OrderInProgress.Load() {
 				return
 			}
-			back_btn.SetDisabled(false)
+			// the order goroutine winds down and gives the buttons back
 			stop_btn.SetDisabled(true)
-			exec_btn.SetDisabled(false)
-			OrderInProgress = false
+			if stopOrder != nil {
+				// abort the request that is currently in flight
+				stopOrder()
+			}
 		})
 		exec_btn = tview.NewButton("Execute Order").SetSelectedFunc(func() {
+			if client.CatalogInfo().Offline {
+				genericModal("You are browsing offline.\nGo online and log in to place orders")
+				return
+			}
+			if !OrderInProgress.CompareAndSwap(false, true) {
+				return
+			}
+			back_btn.SetDisabled(true)
+			stop_btn.SetDisabled(false)
+			exec_btn.SetDisabled(true)
+			ctx, cancel := context.WithCancel(context.Background())
+			stopOrder = cancel
+			// the table, the title and the buttons belong to the UI goroutine,
+			// so the order goroutine changes them through app.QueueUpdateDraw only
 			go func() {
-				if OrderInProgress {
-					return
+				defer cancel()
+				failed := []string{}
+				expired := false
+				// orders that were not fulfilled right away are followed until they settle
+				var (
+					polls     sync.WaitGroup
+					following int
+					settled   []string
+					unsettled []string
+					pollMu    sync.Mutex
+				)
+				setStatus := func(row int, cell *tview.TableCell) {
+					app.QueueUpdateDraw(func() {
+						checkout_table.SetCell(row, 6, cell)
+					})
 				}
-				back_btn.SetDisabled(true)
-				stop_btn.SetDisabled(false)
-				exec_btn.SetDisabled(true)
-				OrderInProgress = true
 				for i, cart_item := range Cart {
-					if !OrderInProgress {
-						return
+					if ctx.Err() != nil {
+						break
 					}
-					var err_p *error
+					row := i + 1
+					var attempts atomic.Int32
+					attempts.Store(1)
 
+					// done stops the spinner once the order is answered, spun tells it has stopped
+					done := make(chan struct{})
+					spun := make(chan struct{})
 					go func() {
-						f := 0
-						for {
-							if err_p != nil {
-								return
-							}
-							checkout_table.SetCell(i+1, 6, tview.NewTableCell(ui.LoaderUIBraile[f%len(ui.LoaderUIBraile)]).
+						defer close(spun)
+						for f := 0; ; f++ {
+							setStatus(row, tview.NewTableCell(attemptLabel(ui.LoaderUIBraile[f%len(ui.LoaderUIBraile)], int(attempts.Load()))).
 								SetTextColor(tcell.ColorOrange).
 								SetAlign(tview.AlignCenter))
-							app.Draw()
-							time.Sleep(time.Millisecond * 100)
-							f++
+							select {
+							case <-done:
+								return
+							case <-time.After(time.Millisecond * 100):
+							}
 						}
 					}()
-					time.Sleep(time.Millisecond * 1500) // Throttle requests
-					od, err := api.ExecOrder(cart_item)
-
-					// return
-					err_p = &err
+					octx := api.WithRetryObserver(ctx, func(ri api.RetryInfo) {
+						attempts.Store(int32(ri.Attempt + 1))
+					})
+					od, err := client.ExecOrder(octx, cart_item)
+					n := int(attempts.Load())
+					close(done)
+					// a spinner frame queued after the result would cover it
+					<-spun
+
+					if err != nil && ctx.Err() != nil {
+						// stopped by the user, this line was not ordered
+						setStatus(row, tview.NewTableCell(" - ").SetTextColor(tcell.ColorGray).SetAlign(tview.AlignCenter))
+						break
+					}
+					appendHistory(newHistoryEntry(cart_item, od, err))
 					if err == nil {
-						if *od.Status == "FULFILLED" {
-							checkout_table.SetCell(i+1, 6, tview.NewTableCell(" ✓ ").SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignCenter))
-						} else {
-							checkout_table.SetCell(i+1, 6, tview.NewTableCell(" ! ").SetTextColor(tcell.ColorDarkOrange).SetAlign(tview.AlignCenter))
+						setStatus(row, orderStatusCell(od, n))
+						if od.Status == nil || *od.Status != "FULFILLED" {
+							polls.Add(1)
+							following++
+							go func(line api.OrderInitData, od api.OrderRespData) {
+								defer polls.Done()
+								final, err := client.WaitForOrder(ctx, od, func(next api.OrderRespData) {
+									setStatus(row, orderStatusCell(next, n))
+								})
+								if err == nil {
+									appendHistory(newHistoryEntry(line, final, nil))
+								}
+								pollMu.Lock()
+								if err == nil {
+									settled = append(settled, orderStatus(final))
+								} else {
+									unsettled = append(unsettled, orderStatus(final))
+								}
+								pollMu.Unlock()
+							}(cart_item, od)
 						}
 					} else {
-						checkout_table.SetCell(i+1, 6, tview.NewTableCell(" X ").SetTextColor(tcell.ColorRed).SetAlign(tview.AlignCenter))
+						mark, reason := describeOrderError(err)
+						failed = append(failed, reason)
+						setStatus(row, tview.NewTableCell(attemptLabel(mark, n)).SetTextColor(tcell.ColorRed).SetAlign(tview.AlignCenter))
+						var ae *api.AuthError
+						if errors.As(err, &ae) {
+							// every following line would be rejected as well
+							expired = true
+							break
+						}
 					}
-					app.Draw()
 				}
+				if following > 0 {
+					title := fmt.Sprintf("Your Order - following %d unfinished order(s), Stop Order to leave them", following)
+					app.QueueUpdateDraw(func() {
+						order_title.SetText(title)
+					})
+				}
+				polls.Wait()
 				// Order finished
-				OrderInProgress = false
-				back_btn.SetDisabled(false)
-				stop_btn.SetDisabled(true)
-				exec_btn.SetDisabled(false)
-				api.UpdateWallets()
-				updateHeaderUI()
-				// show popup
-				genericModal("Order has been finished\nPlease restart your game to see your new assets")
-				app.Draw()
+				OrderInProgress.Store(false)
+				wctx, wcancel := context.WithTimeout(context.Background(), 15*time.Second)
+				client.UpdateWallets(wctx)
+				wcancel()
+				headline := "Order has been finished\nPlease restart your game to see your new assets"
+				switch {
+				case expired:
+					headline = "Your session has expired\nPlease log out and log in again before retrying the order"
+				case ctx.Err() != nil:
+					headline = "Order has been stopped\nPlease restart your game to see the assets bought so far"
+				}
+				summary := headline + failureSummary(failed) + settledSummary(settled, unsettled)
+				app.QueueUpdateDraw(func() {
+					order_title.SetText("Your Order")
+					back_btn.SetDisabled(false)
+					stop_btn.SetDisabled(true)
+					exec_btn.SetDisabled(false)
+					updateHeaderUI()
+					// show popup
+					genericModal(summary)
+				})
 			}()
 		})
 
@@ -895,9 +1607,9 @@ func setupUI() {
 		}
 
 		sel2 := []string{"-- SELECT --"}
-		credit_shop_items := api.GetCreditsItems()
+		credit_shop_items := client.GetCreditsItems()
 		for _, v := range credit_shop_items {
-			sel2 = append(sel2, *v.Name)
+			sel2 = append(sel2, v.Name)
 		}
 
 		order_form = tview.NewForm().
@@ -933,16 +1645,89 @@ func setupUI() {
 					app.Draw()
 				}()
 			})
+		currencyDropDown(order_form, credit_shop_items, &credOrderData.Currency)
 		order_form.SetBorder(true).SetTitle("Order configuration").SetTitleAlign(tview.AlignCenter)
 		entryPage.RemoveItem(order_config_basic).AddItem(order_form, 1, 1, 1, 1, 0, 100, false)
 		app.SetFocus(order_form)
 	}
 
+	settings_sel := func() {
+		if order_form != nil {
+			entryPage.RemoveItem(order_form)
+		}
+		rl := client.RateLimit()
+		order_form = tview.NewForm().
+			AddTextView("Current rate", fmt.Sprintf("%.2f requests/s", client.CurrentRate()), 30, 1, true, false).
+			AddInputField("Max requests/s", strconv.FormatFloat(rl.Rate, 'f', 2, 64), 20, tview.InputFieldFloat, nil).
+			AddInputField("Min requests/s", strconv.FormatFloat(rl.MinRate, 'f', 2, 64), 20, tview.InputFieldFloat, nil).
+			AddInputField("Burst", strconv.Itoa(rl.Burst), 20, onlyNumbers, nil).
+			AddButton("Cancel", func() {
+				entryPage.RemoveItem(order_form).AddItem(order_config_basic, 1, 1, 1, 1, 0, 100, false)
+				app.SetFocus(main_menu_list)
+			}).
+			AddButton("Save", func() {
+				rate, err1 := strconv.ParseFloat(order_form.GetFormItemByLabel("Max requests/s").(*tview.InputField).GetText(), 64)
+				min_rate, err2 := strconv.ParseFloat(order_form.GetFormItemByLabel("Min requests/s").(*tview.InputField).GetText(), 64)
+				burst, err3 := strconv.Atoi(order_form.GetFormItemByLabel("Burst").(*tview.InputField).GetText())
+				if err1 != nil || err2 != nil || err3 != nil || rate <= 0 || min_rate <= 0 || burst <= 0 {
+					genericModal("Error: rates and burst must be positive numbers")
+					return
+				}
+				if min_rate > rate {
+					genericModal("Error: min requests/s cannot exceed max requests/s")
+					return
+				}
+				rl.Rate = rate
+				rl.MinRate = min_rate
+				rl.Burst = burst
+				client.SetRateLimit(rl)
+				settings.RateLimit = rl
+				if err := saveSettings(settings); err != nil {
+					genericModal(fmt.Sprintf("Error: could not save settings: %s", err.Error()))
+					return
+				}
+				order_form.GetFormItemByLabel("Current rate").(*tview.TextView).SetText(fmt.Sprintf("%.2f requests/s", client.CurrentRate()))
+			})
+		order_form.SetBorder(true).SetTitle("Settings").SetTitleAlign(tview.AlignCenter)
+		entryPage.RemoveItem(order_config_basic).AddItem(order_form, 1, 1, 1, 1, 0, 100, false)
+		app.SetFocus(order_form)
+	}
+
+	changes_sel := func() {
+		if order_form != nil {
+			entryPage.RemoveItem(order_form)
+		}
+		d, since := client.CatalogChanges()
+		intro := "No catalog from an earlier login to compare with"
+		report := ""
+		if !since.IsZero() {
+			intro = fmt.Sprintf("Compared to the catalog of %s", since.Local().Format(time.DateTime))
+			if client.CatalogInfo().Refreshing {
+				intro += "\nThe catalog is still being refreshed, check again shortly"
+			}
+			report = catalogDiffReport(d, true)
+		}
+		order_form = tview.NewForm().
+			AddTextView("", intro, 0, 2, false, false).
+			AddTextView("", report, 0, 20, true, true).
+			AddButton("Close", func() {
+				entryPage.RemoveItem(order_form).AddItem(order_config_basic, 1, 1, 1, 1, 0, 100, false)
+				app.SetFocus(main_menu_list)
+			})
+		order_form.SetBorder(true).SetTitle("What changed since last login").SetTitleAlign(tview.AlignCenter)
+		entryPage.RemoveItem(order_config_basic).AddItem(order_form, 1, 1, 1, 1, 0, 100, false)
+		app.SetFocus(order_form)
+	}
+
 	main_menu_list = tview.NewList().
 		AddItem("Buy Basic Preplanning", "Browse basic preplanning assets", 'b', basic_sel).
 		AddItem("Buy Exclusive Preplanning", "Browse heist-exclusive preplanning assets", 'e', exclusive_sel).
 		AddItem("C-Stacks Marketplace", "Buy C-Stacks directly from the source", 's', gold_sel).
 		AddItem("Add Credits", "Buy PayDay Credits from Nebula", 'c', pd_cred).
+		AddItem("Inventory", "Preplanning assets, C-Stacks and other items you own", 'i', showInventory).
+		AddItem("My Orders", "Orders placed with this account and their status", 'm', showOrders).
+		AddItem("What Changed", "New items and price changes since your last login", 'w', changes_sel).
+		AddItem("Settings", "Request rate and other options", 'o', settings_sel).
 		AddItem("Quit", "Press to exit", 'q', func() {
 			app.Stop()
 		})
@@ -953,7 +1738,7 @@ func setupUI() {
 		SetBorders(true).
 		AddItem(newPrimitive(fmt.Sprintf("PayShop3 - Your Personal Black Market | %v", B_VER)), 2, 0, 1, 3, 0, 0, false)
 
-	jumpToEntry := api.LD.DisplayName != ""
+	jumpToEntry := client.Session().DisplayName != ""
 
 	entryPage.
 		AddItem(main_menu_list, 1, 0, 1, 1, 0, 130, true).
@@ -969,6 +1754,7 @@ func setupUI() {
 
 	headerTimedUpdate()
 	updateCartUI()
+	time.AfterFunc(time.Second, cartTimedUpdate)
 	if err := app.SetRoot(pages, true).SetFocus(pages).EnableMouse(true).Run(); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,112 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"context"
+	"payshop3/api"
+
+	"github.com/rivo/tview"
+)
+
+var factor_names = map[string]string{
+	api.FactorAuthenticator: "Authenticator app",
+	api.FactorBackupCode:    "Backup code",
+	api.FactorEmail:         "Email",
+}
+
+// mfaPrompt asks for the second factor of a login stopped by ch and calls
+// onDone once the session is up. Cancel goes back to the login screen.
+func mfaPrompt(ch *api.MFARequiredError, onDone func()) {
+	factors := ch.Factors
+	if len(factors) == 0 {
+		factors = []string{api.FactorAuthenticator}
+	}
+	opts := []string{}
+	selected := 0
+	for i, f := range factors {
+		name, ok := factor_names[f]
+		if !ok {
+			name = f
+		}
+		opts = append(opts, name)
+		if f == ch.DefaultFactor {
+			selected = i
+		}
+	}
+
+	var form *tview.Form
+	// a request is in flight, the buttons wait for it
+	busy := false
+	factor := func() string {
+		i, _ := form.GetFormItemByLabel("Method").(*tview.DropDown).GetCurrentOption()
+		return factors[i]
+	}
+	form = tview.NewForm().
+		AddTextView("Status", "Your account has two-factor authentication enabled.\nEnter the code to continue", 50, 2, true, false).
+		AddDropDown("Method", opts, selected, nil).
+		AddInputField("Code", "", 20, nil, nil).
+		AddCheckbox("Trust this device", false, nil).
+		AddButton("Verify", func() {
+			status := form.GetFormItemByLabel("Status").(*tview.TextView)
+			if busy {
+				return
+			}
+			code := form.GetFormItemByLabel("Code").(*tview.InputField).GetText()
+			trust := form.GetFormItemByLabel("Trust this device").(*tview.Checkbox).IsChecked()
+			f := factor()
+			busy = true
+			status.SetText("Verifying...")
+			ctx := api.WithCatalogProgress(context.Background(), func(loaded int, total int) {
+				app.QueueUpdateDraw(func() {
+					status.SetText(shopProgressText(loaded, total))
+				})
+			})
+			// the session is loaded together with the catalog, off the UI thread
+			go func() {
+				err := client.VerifyMFA(ctx, ch, f, code, trust)
+				app.QueueUpdateDraw(func() {
+					busy = false
+					if err != nil {
+						status.SetText("Error: " + err.Error())
+						return
+					}
+					app.SetRoot(pages, true).SetFocus(pages)
+					onDone()
+				})
+			}()
+		}).
+		AddButton("Email me a code", func() {
+			status := form.GetFormItemByLabel("Status").(*tview.TextView)
+			if busy {
+				return
+			}
+			busy = true
+			status.SetText("Sending a code...")
+			go func() {
+				err := client.SendMFACode(context.Background(), ch)
+				app.QueueUpdateDraw(func() {
+					busy = false
+					if err != nil {
+						status.SetText("Error: " + err.Error())
+						return
+					}
+					status.SetText("A code was sent to your email.\nPick Email as the method to use it")
+				})
+			}()
+		}).
+		AddButton("Cancel", func() {
+			if busy {
+				return
+			}
+			loginForm.GetFormItemByLabel("Status").(*tview.TextView).SetText("Two-factor login cancelled")
+			app.SetRoot(pages, true).SetFocus(pages)
+		}).SetButtonsAlign(tview.AlignCenter)
+	form.SetBorder(true).SetTitle("Two-factor authentication").SetTitleAlign(tview.AlignCenter)
+
+	screen := tview.NewGrid().SetColumns(0, 80, 0).SetRows(0, 15, 0).AddItem(form, 1, 1, 1, 1, 0, 0, true)
+	app.SetRoot(screen, true).SetFocus(form)
+}
@@ -0,0 +1,51 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"payshop3/api"
+	"payshop3/nebulamock"
+	"time"
+)
+
+// runMockServer serves the bundled Nebula stand-in until the process is killed
+func runMockServer(args []string) error {
+	fs := flag.NewFlagSet("mock-server", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8089", "address to listen on")
+	catalog := fs.String("catalog", "", "path to a byCriteria JSON response to serve instead of the built-in catalog")
+	latency := fs.Duration("latency", 0, "delay added to every request")
+	fs.Parse(args)
+
+	srv := nebulamock.New()
+	if *catalog != "" {
+		raw, err := os.ReadFile(*catalog)
+		if err != nil {
+			return err
+		}
+		var sd api.ShopData
+		if err := json.Unmarshal(raw, &sd); err != nil || sd.Data == nil {
+			return fmt.Errorf("could not parse catalog file %s", *catalog)
+		}
+		srv.SetCatalog(*sd.Data)
+	}
+	if *latency > 0 {
+		for _, r := range []string{nebulamock.RouteToken, nebulamock.RouteCatalog, nebulamock.RouteWallet, nebulamock.RouteOrders} {
+			srv.SetLatency(r, *latency)
+		}
+	}
+
+	fmt.Printf("Nebula stand-in listening on http://%s\n", *addr)
+	fmt.Printf("Log in with %s / %s\n", nebulamock.DefaultLogin, nebulamock.DefaultPassword)
+	fmt.Printf("Start the shop with: payshop3 -base-url http://%s\n", *addr)
+
+	hs := &http.Server{Addr: *addr, Handler: srv, ReadHeaderTimeout: 10 * time.Second}
+	return hs.ListenAndServe()
+}
@@ -6,27 +6,24 @@ Copyright (C) 2023  AlexDash
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
 const (
-	nebula_base_url string = "https://nebula.starbreeze.com"
-	basic_auth      string = "Basic MGIzYmZkZjVhMjVmNDUyZmJkMzNhMzYxMzNhMmRlYWI6"
-	cid             string = "d682bcf949cb4744b3cd4295bbdd9fef"
+	basic_auth string = "Basic MGIzYmZkZjVhMjVmNDUyZmJkMzNhMzYxMzNhMmRlYWI6"
 )
 
 var stealth_headers []header = []header{
 	{Key: "User-Agent", Value: "PAYDAY3/++UE4+Release-4.27-CL-0 Windows/10.0.19045.1.256.64bit"},
-	{Key: "Namespace", Value: "pd3"},
 	{Key: "Game-Client-Version", Value: "1.0.0.0"},
 	{Key: "Accelbyte-Sdk-Version", Value: "21.0.3"},
 	{Key: "Accelbyte-Oss-Version", Value: "0.8.11"},
@@ -100,7 +97,9 @@ type ItemRegionData struct {
 	CurrencyType       *string    `json:"currencyType,omitempty"`
 	CurrencyNamespace  *string    `json:"currencyNamespace,omitempty"`
 	PurchaseAt         *time.Time `json:"purchaseAt,omitempty"`
+	ExpireAt           *time.Time `json:"expireAt,omitempty"`
 	DiscountPurchaseAt *time.Time `json:"discountPurchaseAt,omitempty"`
+	DiscountExpireAt   *time.Time `json:"discountExpireAt,omitempty"`
 }
 
 type ItemImageData struct {
@@ -161,6 +160,10 @@ type OrderInitData struct {
 	ReturnUrl       string `json:"returnUrl,omitempty"`
 	PrettyName      string `json:"pretty_name_pshop3,omitempty"`
 	PrettyHeistName string `json:"pretty_heist_name_pshop3,omitempty"`
+	// when the discount in DiscountedPrice ends, zero if it does not
+	DiscountExpireAt time.Time `json:"discount_expire_at_pshop3,omitempty"`
+	// why the quantity is lower than asked for, empty if it is not
+	LimitNote string `json:"limit_note_pshop3,omitempty"`
 }
 
 type OrderErrorData struct {
@@ -172,7 +175,7 @@ type AssetGroupData struct {
 	GroupName  string
 	PrettyName string
 	Sku        string
-	Bank       []ShopItemData
+	Items      []Item
 }
 
 type WalletLinkedData struct {
@@ -203,12 +206,38 @@ type WalletData struct {
 	Id             *string             `json:"id,omitempty"`
 }
 
+type EntitlementData struct {
+	Id              *string    `json:"id,omitempty"`
+	Namespace       *string    `json:"namespace,omitempty"`
+	Clazz           *string    `json:"clazz,omitempty"`
+	Type            *string    `json:"type,omitempty"`
+	Status          *string    `json:"status,omitempty"`
+	Sku             *string    `json:"sku,omitempty"`
+	UserId          *string    `json:"userId,omitempty"`
+	ItemId          *string    `json:"itemId,omitempty"`
+	Name            *string    `json:"name,omitempty"`
+	UseCount        *int       `json:"useCount,omitempty"`
+	Quantity        *int       `json:"quantity,omitempty"`
+	Source          *string    `json:"source,omitempty"`
+	Stackable       *bool      `json:"stackable,omitempty"`
+	GrantedAt       *time.Time `json:"grantedAt,omitempty"`
+	CreatedAt       *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time `json:"updatedAt,omitempty"`
+	StartDate       *time.Time `json:"startDate,omitempty"`
+	EndDate         *time.Time `json:"endDate,omitempty"`
+	GrantedCode     *string    `json:"grantedCode,omitempty"`
+	ItemNamespace   *string    `json:"itemNamespace,omitempty"`
+	StackedUseCount *int       `json:"stackedUseCount,omitempty"`
+	StackedQuantity *int       `json:"stackedQuantity,omitempty"`
+}
+
 type BasicOrderData struct {
 	ItemTypeID int
 	ItemType   string
 	BuyTypeID  int
 	BuyType    string
 	Amount     int
+	Currency   string
 }
 
 type ExclusiveOrderData struct {
@@ -220,6 +249,7 @@ type ExclusiveOrderData struct {
 	BuyTypeID   int
 	BuyType     string
 	Amount      int
+	Currency    string
 }
 
 type TokenClaims struct {
@@ -249,172 +279,220 @@ type GoldOrderData struct {
 	BuyTypeID int
 	BuyType   string
 	Amount    int
+	Currency  string
 }
 
 type CreditOrderData struct {
 	ItemType string
 	Amount   int
+	Currency string
 }
 
-var LD LoginData = LoginData{}
-var Shop ShopData = ShopData{}
-var Wallets []WalletData = []WalletData{}
-var logout bool = true
-
 // Initialize login details
-func Init(login string, password string, save bool) error {
+func (c *Client) Init(ctx context.Context, login string, password string, remember Remember) error {
 	if login == "" || password == "" {
 		return errors.New("login or password cannot be empty")
 	}
-	LD = LoginData{}
-	logout = false
-
-	authResp, status, err := apicall("/iam/v3/oauth/token", "POST", []header{
-		{Key: "Authorization", Value: basic_auth},
-		{Key: "Content-Type", Value: "application/x-www-form-urlencoded;charset=UTF-8"},
-	}, fmt.Sprintf("grant_type=password&client_id=%s&username=%s&password=%s&extend_exp=true", cid, login, password))
-
-	if err != nil || status != 200 {
-		logout = true
-		return errors.New("login or password is incorrect")
+	if remember != RememberNothing && c.sessionStore() == nil {
+		return errors.New("a passphrase is required to save login info")
 	}
+	c.tokens.stop()
 
-	err = json.Unmarshal(authResp, &LD)
-	if err != nil {
-		logout = true
-		return errors.New("unexpected server response on attempted auth")
-	}
-	LD.TokenUpdatedAt = time.Now()
-	LD.RefreshUpdatedAt = time.Now()
-	LD.AutoLogin = save
-	if save {
-		LD.Password = password
-		LD.Login = login
-		savedata, _ := json.Marshal(LD)
-		os.WriteFile("payshop3_logindata.json", savedata, 0644)
-	} else {
-		os.Remove("payshop3_logindata.json")
-	}
-
-	Shop, err = GetShop()
+	ld, err := c.passwordGrant(ctx, login, password, "")
+	var mfa *MFARequiredError
+	if errors.As(err, &mfa) {
+		// finished by VerifyMFA
+		mfa.login, mfa.password, mfa.remember = login, password, remember
+		return mfa
+	}
 	if err != nil {
-		logout = true
 		return err
 	}
+	return c.begin(ctx, ld, login, password, remember)
+}
 
-	err = UpdateWallets()
-	if err != nil {
-		logout = true
+// begin installs a session issued for login and loads the account
+func (c *Client) begin(ctx context.Context, ld LoginData, login string, password string, remember Remember) error {
+	ld.AutoLogin = remember != RememberNothing
+	switch remember {
+	case RememberPassword:
+		ld.Password = password
+		ld.Login = login
+	case RememberNothing:
+		c.forget()
+	}
+	// starts the background refresh as well
+	c.tokens.start(ld, remember)
+	if err := c.loadAccount(ctx); err != nil {
+		// a login that never loaded must not be resumed on the next start
+		c.forget()
 		return err
 	}
-
-	// auto refresh tokens
-	time.AfterFunc(time.Minute, func() { UpdateTokenInfo(save, true, false) })
-
 	return nil
 }
 
-func GetShop() (ShopData, error) {
-	var sd ShopData
-	shopRaw, status, err := apicall("/platform/public/namespaces/pd3/items/byCriteria?limit=2147483647&includeSubCategoryItem=true", "GET", []header{}, "")
-
-	if err != nil || status != 200 {
-		return sd, errors.New("failed to query the shop")
+// Resume logs in again from a saved session without asking for the password.
+// The refresh token is tried first; the saved password, if any, is the fallback.
+// A saved session the server refuses is forgotten.
+func (c *Client) Resume(ctx context.Context, saved LoginData) error {
+	remember := RememberSession
+	if saved.Login != "" && saved.Password != "" {
+		remember = RememberPassword
 	}
+	c.tokens.stop()
 
-	err = json.Unmarshal(shopRaw, &sd)
+	ld, err := c.renew(ctx, saved)
 	if err != nil {
-		return sd, errors.New("failed to parse shop response")
+		var ae *AuthError
+		if errors.As(err, &ae) {
+			c.forget()
+		}
+		return err
 	}
-
-	return sd, nil
+	c.tokens.start(ld, remember)
+	return c.loadAccount(ctx)
 }
 
-func UpdateShop() error {
+// loadAccount fetches the shop and wallets of a new session. A fresh cached
+// catalog is used right away and refreshed in the background instead.
+func (c *Client) loadAccount(ctx context.Context) error {
 	var err error
-	Shop, err = GetShop()
-	return err
-}
+	c.shopMu.Lock()
+	c.shopInfo.Offline = false
+	c.shopMu.Unlock()
+	fresh := c.cachedShopFresh()
+	c.shopMu.Lock()
+	c.baseline, c.baselineAt = c.shop, c.shopInfo.FetchedAt
+	c.shopMu.Unlock()
+	if fresh {
+		c.RefreshShopInBackground(nil)
+	} else if err = c.UpdateShop(ctx); err != nil {
+		c.tokens.stop()
+		return err
+	}
 
-func apicall(path string, method string, headers []header, body string) ([]byte, int, error) {
-	req, err := http.NewRequest(method, nebula_base_url+path, strings.NewReader(body))
+	err = c.UpdateWallets(ctx)
 	if err != nil {
-		return []byte{}, 0, err
+		c.tokens.stop()
+		return err
 	}
 
-	// Main Headers
-	for _, v := range headers {
-		req.Header.Set(v.Key, v.Value)
+	// purchase limits are checked without owned items when this fails, Nebula has the last word
+	if err := c.UpdateEntitlements(ctx); err != nil {
+		c.log.Printf("entitlements not loaded: %v", err)
 	}
 
-	// Stealth
-	for _, v := range stealth_headers {
-		req.Header.Set(v.Key, v.Value)
-	}
+	return nil
+}
 
-	// Postlogin auth headers
-	if LD.Token != "" {
-		req.Header.Set("Authorization", LD.TokenType+" "+LD.Token)
-		req.Header.Set("Cookie", fmt.Sprintf("access_token=%s; refresh_token=%s", LD.Token, LD.RefreshToken))
-	}
+// GetShop downloads the catalog page by page, following paging.next. Progress
+// goes to the CatalogProgress set on ctx with WithCatalogProgress.
+func (c *Client) GetShop(ctx context.Context) (ShopData, error) {
+	sd, _, err := c.fetchShop(ctx)
+	return sd, err
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return []byte{}, 0, err
+// fetchShop downloads the catalog priced for the country of the user, or for the
+// default region of the store when it has nothing for that country. It returns
+// the region asked for, empty for the default one.
+func (c *Client) fetchShop(ctx context.Context) (ShopData, string, error) {
+	if region := c.Country(); region != "" {
+		sd, err := c.getShopIn(ctx, region)
+		if err != nil || len(*sd.Data) > 0 {
+			return sd, region, err
+		}
 	}
+	sd, err := c.getShopIn(ctx, "")
+	return sd, "", err
+}
+
+func (c *Client) getShopIn(ctx context.Context, region string) (ShopData, error) {
+	estimate := len(c.shopItems())
+	items := []ShopItemData{}
+	path := c.nsPath("/items/byCriteria?offset=0&limit=%d&includeSubCategoryItem=true", CatalogPageSize)
+	if region != "" {
+		path += "&region=" + url.QueryEscape(region)
+	}
+	seen := map[string]bool{}
+	for path != "" && !seen[path] {
+		seen[path] = true
+		var page []ShopItemData
+		var next string
+		_, err := c.stream(ctx, path, "GET", []header{}, "", 200, func(r io.Reader) error {
+			// a retried page starts from scratch
+			page = page[:0]
+			var err error
+			next, err = decodeCatalogPage(r, func(item ShopItemData) {
+				page = append(page, item)
+				loaded := len(items) + len(page)
+				if estimate < loaded {
+					estimate = loaded
+				}
+				if loaded%catalogProgressStep == 0 {
+					notifyCatalogProgress(ctx, loaded, estimate)
+				}
+			})
+			return err
+		})
+		if err != nil {
+			return ShopData{}, fmt.Errorf("failed to query the shop: %w", err)
+		}
+		items = append(items, page...)
+		notifyCatalogProgress(ctx, len(items), estimate)
+		if len(page) == 0 || next == "" {
+			break
+		}
+		path, err = nextPagePath(next)
+		if err != nil {
+			return ShopData{}, errors.New("failed to parse shop response")
+		}
+	}
+	notifyCatalogProgress(ctx, len(items), len(items))
+	return ShopData{Data: &items}, nil
+}
 
-	resBody, err := io.ReadAll(res.Body)
+// UpdateShop downloads the catalog and saves it to the catalog cache
+func (c *Client) UpdateShop(ctx context.Context) error {
+	sd, region, err := c.fetchShop(ctx)
 	if err != nil {
-		return []byte{}, 0, err
+		if ctx.Err() == nil {
+			c.shopFailed(err)
+		}
+		return err
 	}
-
-	return resBody, res.StatusCode, nil
+	info := CatalogInfo{FetchedAt: c.now(), Region: region}
+	if !c.setShopUnlessDone(ctx, sd, info) {
+		return ctx.Err()
+	}
+	if err := c.saveCatalogCache(sd, info); err != nil {
+		c.log.Printf("catalog cache not saved: %v", err)
+	}
+	return nil
 }
 
-func LookupItemByIdLocal(id string) (ShopItemData, error) {
-	for _, v := range *Shop.Data {
-		if *v.ItemId == id {
-			return v, nil
-		}
+func (c *Client) LookupItemByIdLocal(id string) (Item, error) {
+	if v, ok := c.Catalog().ById(id); ok {
+		return v, nil
 	}
-	return ShopItemData{}, errors.New("item with given id was not found locally")
+	return Item{}, errors.New("item with given id was not found locally")
 }
 
-func BuyItem(id string, quantity int) (OrderRespData, error) {
-	item, err := LookupItemByIdLocal(id)
+func (c *Client) BuyItem(ctx context.Context, id string, quantity int) (OrderRespData, error) {
+	item, err := c.LookupItemByIdLocal(id)
 	if err != nil {
 		return OrderRespData{}, err
 	}
-	rd := *item.RegionData
-
-	body, _ := json.Marshal(OrderInitData{
-		ItemId:          *item.ItemId,
-		Quantity:        quantity,
-		Price:           *rd[0].Price * quantity,
-		DiscountedPrice: *rd[0].DiscountedPrice * quantity,
-		CurrencyCode:    *rd[0].CurrencyCode,
-		Region:          *item.Region,
-		Language:        *item.Language,
-		ReturnUrl:       "http://127.0.0.1",
-	})
-
-	orderRaw, status, err := apicall(fmt.Sprintf("/platform/public/namespaces/pd3/users/%s/orders", LD.UserId), "POST", []header{}, string(body))
-	if err != nil || status != 201 {
+	price, err := c.ResolvePrice(item, "")
+	if err != nil {
 		return OrderRespData{}, err
 	}
+	oid := item.Order(price, quantity)
+	oid.PrettyName, oid.PrettyHeistName = "", ""
+	body, _ := json.Marshal(oid)
 
-	if status == 400 {
-		// parse error
-		e := OrderErrorData{}
-		err = json.Unmarshal(orderRaw, &e)
-		if err != nil {
-			return OrderRespData{}, errors.New("failed to parse order error data")
-		}
-		if e.ErrorMessage != nil {
-			// return payment order error
-			return OrderRespData{}, errors.New(*e.ErrorMessage)
-		}
-		return OrderRespData{}, errors.New("failed to place an order")
+	orderRaw, err := c.request(ctx, c.nsPath("/users/%s/orders", c.Session().UserId), "POST", []header{}, string(body), 201)
+	if err != nil {
+		return OrderRespData{}, err
 	}
 
 	order := OrderRespData{}
@@ -425,186 +503,88 @@ func BuyItem(id string, quantity int) (OrderRespData, error) {
 	return order, nil
 }
 
-func GetExclusivePreplanningAssets() []ShopItemData {
-	arr := []ShopItemData{}
-	for _, v := range *Shop.Data {
-		if *v.CategoryPath == "/PreplanningAssets" {
-			arr = append(arr, v)
-		}
-	}
-	return arr
+func (c *Client) GetExclusivePreplanningAssets() []Item {
+	return c.Catalog().InCategory(preplanningCategory)
 }
 
-func GetAssetBank() []AssetGroupData {
-	agd := []AssetGroupData{}
-	for _, v := range *Shop.Data {
-		if *v.CategoryPath != "/PreplanningAssets" {
-			continue
-		}
-		sku := strings.Split(*v.Sku, "_")[2]
-		f := false
-		for i, s := range agd {
-			if s.Sku == sku {
-				agd[i].Bank = append(agd[i].Bank, v)
-				f = true
-				break
-			}
-		}
-		if !f {
-			t := []ShopItemData{v}
-			agd = append(agd, AssetGroupData{Sku: sku, Bank: t})
-		}
-	}
-	return agd
+func (c *Client) GetAssetBank() []AssetGroupData {
+	return c.Catalog().AssetBank()
 }
 
-func UpdateWallets() error {
+func (c *Client) UpdateWallets(ctx context.Context) error {
 	arr := []string{"CASH", "GOLD", "CRED"}
-	Wallets = []WalletData{}
+	wallets := []WalletData{}
 	for _, w := range arr {
 		var wd WalletData
-		walletRaw, status, err := apicall(fmt.Sprintf("/platform/public/namespaces/pd3/users/%s/wallets/%s", LD.UserId, w), "GET", []header{}, "")
+		walletRaw, err := c.request(ctx, c.nsPath("/users/%s/wallets/%s", c.Session().UserId, w), "GET", []header{}, "", 200)
 
-		if err != nil || status != 200 {
-			return errors.New("failed to update wallets")
+		if err != nil {
+			return fmt.Errorf("failed to update wallets: %w", err)
 		}
 
 		err = json.Unmarshal(walletRaw, &wd)
 		if err != nil {
 			return errors.New("failed to parse wallet response")
 		}
-		Wallets = append(Wallets, wd)
+		wallets = append(wallets, wd)
 	}
+	c.setWallets(wallets)
 	return nil
 }
 
-func GetCachedWalletByCode(c string) (WalletData, error) {
-	for _, v := range Wallets {
-		if *v.CurrencyCode == c {
+// Wallets returns the wallets loaded by the last UpdateWallets
+func (c *Client) Wallets() []WalletData {
+	c.walletMu.RLock()
+	defer c.walletMu.RUnlock()
+	return append([]WalletData{}, c.wallets...)
+}
+
+func (c *Client) setWallets(wallets []WalletData) {
+	c.walletMu.Lock()
+	c.wallets = wallets
+	c.walletMu.Unlock()
+}
+
+func (c *Client) GetCachedWalletByCode(code string) (WalletData, error) {
+	for _, v := range c.Wallets() {
+		if v.CurrencyCode != nil && *v.CurrencyCode == code {
 			return v, nil
 		}
 	}
-	return WalletData{}, fmt.Errorf("wallet %s could not be found", c)
+	return WalletData{}, fmt.Errorf("wallet %s could not be found", code)
 }
 
-func GetExclusiveAssetGroupBySku(sku string) AssetGroupData {
-
-	for _, v := range GetAssetBank() {
-		if v.Sku == sku {
-			return v
-		}
+func (c *Client) GetExclusiveAssetGroupBySku(sku string) AssetGroupData {
+	if agd, ok := c.Catalog().AssetGroup(sku); ok {
+		return agd
 	}
 
 	var agd AssetGroupData
-	agd.Bank = []ShopItemData{}
+	agd.Items = []Item{}
 	return agd
 }
 
-func UpdateTokenInfo(save bool, recursive bool, force bool) error {
-
-	if logout {
-		return nil
-	}
-	ttl_t := GetTimeLeftJWT(LD.Token) > 120
-	ttl_rt := GetTimeLeftJWT(LD.RefreshToken) > 120
-
-	if ttl_t && !recursive && !force {
-		// tokens are valid, no need to update
-		return nil
-	}
-	rt := LD.RefreshToken
-	autologin := LD.AutoLogin
-	lg := LD.Login
-	pwd := LD.Password
-
-	if !ttl_t && ttl_rt && !force {
-		LD = LoginData{}
-
-		authResp, status, err := apicall("/iam/v3/oauth/token", "POST", []header{
-			{Key: "Authorization", Value: basic_auth},
-			{Key: "Content-Type", Value: "application/x-www-form-urlencoded;charset=UTF-8"},
-		}, fmt.Sprintf("grant_type=refresh_token&refresh_token=%s", rt))
-
-		if err != nil || status != 200 {
-			// try credentials
-			force = true
-		} else {
-			// all good
-			err = json.Unmarshal(authResp, &LD)
-			if err != nil {
-				return errors.New("unexpected server response on attempted token refresh")
-			}
-		}
-	}
-
-	if (!ttl_t && !ttl_rt) || force {
-		// update via credentials
-		LD = LoginData{}
-		authResp, status, err := apicall("/iam/v3/oauth/token", "POST", []header{
-			{Key: "Authorization", Value: basic_auth},
-			{Key: "Content-Type", Value: "application/x-www-form-urlencoded;charset=UTF-8"},
-		}, fmt.Sprintf("grant_type=password&client_id=%s&username=%s&password=%s&extend_exp=true", cid, lg, pwd))
-
-		if err != nil || status != 200 {
-			return errors.New("login or password is incorrect")
-		}
-
-		err = json.Unmarshal(authResp, &LD)
-		if err != nil {
-			return errors.New("unexpected server response on attempted auth")
-		}
-	}
-
-	LD.TokenUpdatedAt = time.Now()
-	LD.RefreshUpdatedAt = time.Now()
-	LD.AutoLogin = autologin
-
-	if save {
-		// save new login info to file
-		LD.Password = pwd
-		LD.Login = lg
-		savedata, _ := json.Marshal(LD)
-		os.WriteFile("payshop3_logindata.json", savedata, 0644)
+func (c *Client) GetItemBySKU(sku string) (Item, error) {
+	if v, ok := c.Catalog().BySku(sku); ok {
+		return v, nil
 	}
-
-	if !recursive {
-		return nil
-	}
-
-	time.AfterFunc(time.Minute, func() { UpdateTokenInfo(save, true, false) })
-	return nil
+	return Item{}, errors.New("item was not found in the shop")
 }
 
-func GetTimeLeftJWT(tokenString string) int {
-	cl := TokenClaims{}
-	jwt.ParseWithClaims(tokenString, &cl, func(token *jwt.Token) (interface{}, error) {
-		return []byte(""), nil
-	})
-	return *cl.ExpiresAt - int(time.Now().Unix())
+func (c *Client) safeguard(itemid string) bool {
+	v, ok := c.Catalog().ById(itemid)
+	return ok && v.ForSale()
 }
 
-func GetItemBySKU(sku string) (ShopItemData, error) {
-	for _, v := range *Shop.Data {
-		if *v.Sku == sku {
-			return v, nil
-		}
+func (c *Client) ExecOrder(ctx context.Context, item OrderInitData) (OrderRespData, error) {
+	if !c.safeguard(item.ItemId) {
+		return OrderRespData{}, &ItemUnavailableError{APIError{Message: "item was not found or not publicly avalible for purchase"}}
 	}
-	return ShopItemData{}, errors.New("item was not found in the shop")
-}
-
-func safeguard(itemid string) bool {
-	for _, v := range *Shop.Data {
-		if *v.ItemId == itemid {
-			return *v.Purchasable && *v.Listable
+	if it, ok := c.Catalog().ById(item.ItemId); ok {
+		if lim := c.LimitFor(it, 0); lim.Left >= 0 && item.Quantity > lim.Left {
+			return OrderRespData{}, &LimitExceededError{APIError{Message: fmt.Sprintf("at most %d more can be ordered: %s", lim.Left, lim.Reason)}}
 		}
 	}
-	return false
-}
-
-func ExecOrder(item OrderInitData) (OrderRespData, error) {
-	if !safeguard(item.ItemId) {
-		return OrderRespData{}, errors.New("item was not found or not publicly avalible for purchase")
-	}
 
 	// Create a clear object so the server wouldn't get confused
 	body, err := json.Marshal(OrderInitData{
@@ -620,50 +600,103 @@ func ExecOrder(item OrderInitData) (OrderRespData, error) {
 	if err != nil {
 		return OrderRespData{}, errors.New("failed to create order object")
 	}
-	orderResp, status, err := apicall(fmt.Sprintf("/platform/public/namespaces/pd3/users/%s/orders", LD.UserId), "POST", []header{
+	orderResp, err := c.request(ctx, c.nsPath("/users/%s/orders", c.Session().UserId), "POST", []header{
 		{Key: "Content-Type", Value: "application/json"},
 		{Key: "Accept", Value: "application/json"},
-	}, string(body))
-	if err != nil || status != 201 {
-		if err == nil {
-			var er OrderErrorData
-			err_j := json.Unmarshal(orderResp, &er)
-			if err_j != nil {
-				fmt.Println(string(orderResp))
-				return OrderRespData{}, err_j
-			}
-			return OrderRespData{}, errors.New(*er.ErrorMessage)
-		}
-		return OrderRespData{}, fmt.Errorf("failed to execute order for itemId: %v", item.ItemId)
+	}, string(body), 201)
+	if err != nil {
+		return OrderRespData{}, err
 	}
 
 	var resp OrderRespData
-	err_jr := json.Unmarshal(orderResp, &resp)
-	if err_jr != nil {
-		fmt.Println(string(orderResp))
-		return OrderRespData{}, err_jr
+	err = json.Unmarshal(orderResp, &resp)
+	if err != nil {
+		return OrderRespData{}, fmt.Errorf("failed to read order response for itemId %v: %w", item.ItemId, err)
 	}
+	c.noteOwned(item.ItemId, item.Quantity)
 
 	return resp, nil
 }
 
-func GetCreditsItems() []ShopItemData {
-	sid := []ShopItemData{}
-	for _, v := range *Shop.Data {
-		if v.TargetCurrencyCode == nil {
-			continue
-		}
-		if *v.TargetCurrencyCode == "CRED" && *v.Purchasable && *v.Listable {
+func (c *Client) GetCreditsItems() []Item {
+	sid := []Item{}
+	for _, v := range c.Catalog().ForTargetCurrency("CRED") {
+		if v.ForSale() {
 			sid = append(sid, v)
 		}
 	}
 	return sid
 }
 
-func Logout() {
-	LD = LoginData{}
-	Shop = ShopData{}
-	Wallets = []WalletData{}
-	logout = true
-	os.Remove("payshop3_logindata.json")
+// Logout ends the session and revokes its tokens on Nebula. The local part
+// always happens; the error only tells that the revocation did not go through.
+func (c *Client) Logout(ctx context.Context) error {
+	ld := c.tokens.session()
+	c.tokens.stop()
+	c.stopShopRefresh()
+	c.setShop(ShopData{}, CatalogInfo{})
+	c.setWallets([]WalletData{})
+	c.clearEntitlements()
+	c.forget()
+	return c.revoke(ctx, ld)
+}
+
+// LogoutEverywhere logs out like Logout and discards the sessions saved in
+// loginFiles as well. The ones the current passphrase unlocks are revoked on
+// Nebula before they are deleted; the others are deleted only.
+func (c *Client) LogoutEverywhere(ctx context.Context, loginFiles []string) error {
+	var errs []error
+	current, _ := c.sessionStore().(*EncryptedFileStore)
+	for _, path := range loginFiles {
+		if current != nil && path != current.Path {
+			if ld, err := current.sibling(path).Load(); err == nil {
+				if err := c.revoke(ctx, ld); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.Logout(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// RevokeToken invalidates an access or refresh token on Nebula
+func (c *Client) RevokeToken(ctx context.Context, token string) error {
+	_, err := c.request(ctx, "/iam/v3/oauth/revoke", "POST", []header{
+		{Key: "Authorization", Value: basic_auth},
+		{Key: "Content-Type", Value: "application/x-www-form-urlencoded;charset=UTF-8"},
+	}, url.Values{"token": {token}}.Encode(), 200)
+	if err != nil {
+		return fmt.Errorf("failed to revoke the session: %w", err)
+	}
+	return nil
+}
+
+// revoke invalidates both tokens of a session, refresh token first so it cannot mint new ones
+func (c *Client) revoke(ctx context.Context, ld LoginData) error {
+	var errs []error
+	for _, t := range []string{ld.RefreshToken, ld.Token} {
+		if t == "" {
+			continue
+		}
+		if err := c.RevokeToken(ctx, t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Disconnect leaves the session like Logout does, but keeps the saved login for later
+func (c *Client) Disconnect() {
+	c.tokens.stop()
+	c.stopShopRefresh()
+	c.setShop(ShopData{}, CatalogInfo{})
+	c.setWallets([]WalletData{})
+	c.clearEntitlements()
+	c.SetSessionStore(nil)
 }
@@ -0,0 +1,241 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestInitLoadsAccount(t *testing.T) {
+	_, c := loggedIn(t, nil)
+
+	if !c.LoggedIn() {
+		t.Fatal("not logged in after Init")
+	}
+	if got := c.Session().UserId; got != nebulamock.DefaultUserId {
+		t.Errorf("user id %q, want %q", got, nebulamock.DefaultUserId)
+	}
+	if got, want := c.Catalog().Len(), len(nebulamock.DefaultCatalog()); got != want {
+		t.Errorf("%d catalog items, want %d", got, want)
+	}
+	if got := c.WalletCurrencies(); len(got) != 3 {
+		t.Errorf("wallets %v, want CASH, GOLD and CRED", got)
+	}
+	if got := balance(t, c, "CASH"); got != 50000000 {
+		t.Errorf("CASH balance %d, want 50000000", got)
+	}
+}
+
+func TestInitWrongPassword(t *testing.T) {
+	_, url := startMock(t)
+	c := newClient(t, url)
+
+	err := c.Init(context.Background(), nebulamock.DefaultLogin, "wrong", api.RememberNothing)
+	var ae *api.AuthError
+	if !errors.As(err, &ae) {
+		t.Fatalf("got %v, want an AuthError", err)
+	}
+	if c.LoggedIn() {
+		t.Error("logged in with a wrong password")
+	}
+}
+
+func TestUpdateTokenInfoRefreshes(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	old := c.Session()
+
+	if err := c.UpdateTokenInfo(context.Background(), true); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	ld := c.Session()
+	if ld.Token == old.Token || ld.RefreshToken == old.RefreshToken {
+		t.Error("the refresh kept the old tokens")
+	}
+	if got := mock.Hits(nebulamock.RouteToken); got != 2 {
+		t.Errorf("%d token requests, want the login and one refresh", got)
+	}
+	if err := c.UpdateWallets(context.Background()); err != nil {
+		t.Errorf("the refreshed session does not work: %v", err)
+	}
+}
+
+func TestRejectedTokenRenewedOnce(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.FailNext(nebulamock.RouteWallet, nebulamock.Failure{Status: 401, ErrorCode: api.ErrCodeUnauthorized}, 1)
+
+	if err := c.UpdateWallets(context.Background()); err != nil {
+		t.Fatalf("wallets after a rejected token: %v", err)
+	}
+	if got := mock.Hits(nebulamock.RouteToken); got != 2 {
+		t.Errorf("%d token requests, want the login and one refresh", got)
+	}
+}
+
+func TestConcurrentRefreshesCollapse(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.SetLatency(nebulamock.RouteToken, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.UpdateTokenInfo(context.Background(), true); err != nil {
+				t.Errorf("refresh failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := mock.Hits(nebulamock.RouteToken); got != 2 {
+		t.Errorf("%d token requests, want the login and one shared refresh", got)
+	}
+}
+
+func TestResumeSavedSession(t *testing.T) {
+	_, url := startMock(t)
+	c := newClient(t, url)
+	if err := c.Init(context.Background(), nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberNothing); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	saved := c.Session()
+	c.Disconnect()
+
+	c2 := newClient(t, url)
+	if err := c2.Resume(context.Background(), saved); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if got := c2.Session().UserId; got != nebulamock.DefaultUserId {
+		t.Errorf("user id %q, want %q", got, nebulamock.DefaultUserId)
+	}
+	if c2.Session().RefreshToken == saved.RefreshToken {
+		t.Error("the resumed session kept the saved refresh token")
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	mock, url := startMock(t)
+	c := newClient(t, url)
+	ctx := context.Background()
+	if err := c.Init(ctx, nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberNothing); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	saved := c.Session()
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if got := mock.Hits(nebulamock.RouteRevoke); got != 2 {
+		t.Errorf("%d revoke requests, want the refresh and the access token", got)
+	}
+	if c.LoggedIn() {
+		t.Error("still logged in after the logout")
+	}
+
+	err := newClient(t, url).Resume(ctx, saved)
+	var ae *api.AuthError
+	if !errors.As(err, &ae) {
+		t.Errorf("resumed a revoked session: %v", err)
+	}
+}
+
+func TestCatalogPaging(t *testing.T) {
+	size := 3*api.CatalogPageSize + 7
+	mock, c := loggedIn(t, func(m *nebulamock.Server) {
+		m.SetCatalog(nebulamock.SyntheticCatalog(size))
+	})
+
+	if got := c.Catalog().Len(); got != size {
+		t.Errorf("%d catalog items, want %d", got, size)
+	}
+	if got := mock.Hits(nebulamock.RouteCatalog); got != 4 {
+		t.Errorf("%d catalog pages fetched, want 4", got)
+	}
+
+	loaded := 0
+	ctx := api.WithCatalogProgress(context.Background(), func(n int, total int) {
+		loaded = n
+	})
+	if err := c.UpdateShop(ctx); err != nil {
+		t.Fatalf("catalog reload failed: %v", err)
+	}
+	if loaded != size {
+		t.Errorf("progress stopped at %d of %d items", loaded, size)
+	}
+}
+
+// the checkout updates the wallets while the header reads them
+func TestWalletsReadDuringUpdate(t *testing.T) {
+	_, c := loggedIn(t, nil)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := c.UpdateWallets(ctx); err != nil {
+				t.Errorf("wallets failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for _, w := range c.Wallets() {
+				_ = w.Balance
+			}
+			c.GetCachedWalletByCode("CASH")
+		}()
+	}
+	wg.Wait()
+	if got := len(c.Wallets()); got != 3 {
+		t.Errorf("%d wallets after the updates, want 3", got)
+	}
+}
+
+func TestBuyItemCheckout(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	id := nebulamock.MockItemId(ammo_bag)
+
+	od, err := c.BuyItem(context.Background(), id, 2)
+	if err != nil {
+		t.Fatalf("order failed: %v", err)
+	}
+	if od.Status == nil || *od.Status != "FULFILLED" {
+		t.Errorf("order status %v, want FULFILLED", od.Status)
+	}
+	if got := len(mock.Orders(nebulamock.DefaultUserId)); got != 1 {
+		t.Errorf("%d orders placed, want 1", got)
+	}
+
+	if err := c.UpdateWallets(context.Background()); err != nil {
+		t.Fatalf("wallets failed: %v", err)
+	}
+	if got := balance(t, c, "CASH"); got != 50000000-2*25000 {
+		t.Errorf("CASH balance %d after the order, want %d", got, 50000000-2*25000)
+	}
+}
+
+func TestCancelledCheckoutReturns(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.SetLatency(nebulamock.RouteOrders, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := c.BuyItem(ctx, nebulamock.MockItemId(ammo_bag), 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if waited := time.Since(start); waited > time.Second/2 {
+		t.Errorf("order returned after %v, not on cancel", waited)
+	}
+}
@@ -0,0 +1,246 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	CatalogCacheFile string = "payshop3_catalog.json"
+	// a cached catalog younger than this is used without waiting for Nebula
+	DefaultCatalogMaxAge time.Duration = time.Hour
+)
+
+// CatalogInfo tells where the catalog in memory came from
+type CatalogInfo struct {
+	FetchedAt time.Time
+	// loaded from the cache file rather than downloaded in this run
+	FromCache bool
+	// older than the max age, or the last refresh failed
+	Stale bool
+	// no session, the catalog is for browsing only
+	Offline    bool
+	Refreshing bool
+	LastError  error
+	// entries left out because they failed validation
+	Rejected int
+	// region the prices are for, empty for the default region of the store
+	Region string
+}
+
+// catalogCache is the on-disk form of the catalog. Every item keeps its own updatedAt.
+type catalogCache struct {
+	Version   int            `json:"version"`
+	BaseURL   string         `json:"base_url"`
+	Namespace string         `json:"namespace"`
+	FetchedAt time.Time      `json:"fetched_at"`
+	Region    string         `json:"region,omitempty"`
+	Items     []ShopItemData `json:"items"`
+}
+
+// WithCatalogCache keeps the catalog in path between runs; maxAge 0 means DefaultCatalogMaxAge
+func WithCatalogCache(path string, maxAge time.Duration) Option {
+	return func(c *Client) {
+		c.cachePath = path
+		c.cacheMaxAge = maxAge
+	}
+}
+
+func (c *Client) maxCatalogAge() time.Duration {
+	if c.cacheMaxAge > 0 {
+		return c.cacheMaxAge
+	}
+	return DefaultCatalogMaxAge
+}
+
+func (c *Client) shopItems() []ShopItemData {
+	return c.Catalog().Raw()
+}
+
+// Catalog returns the index of the catalog in memory. It is rebuilt on every
+// shop load, so callers holding an older one keep a consistent view.
+func (c *Client) Catalog() *Catalog {
+	c.shopMu.RLock()
+	cat := c.catalog
+	c.shopMu.RUnlock()
+	if cat == nil {
+		return NewCatalog([]ShopItemData{})
+	}
+	return cat
+}
+
+// Shop returns the catalog in memory as downloaded
+func (c *Client) Shop() ShopData {
+	c.shopMu.RLock()
+	defer c.shopMu.RUnlock()
+	return c.shop
+}
+
+func (c *Client) setShop(sd ShopData, info CatalogInfo) {
+	c.setShopUnlessDone(context.Background(), sd, info)
+}
+
+// setShopUnlessDone is setShop for a catalog downloaded under ctx. The catalog
+// is dropped if ctx ended in the meantime, e.g. when the session was left.
+func (c *Client) setShopUnlessDone(ctx context.Context, sd ShopData, info CatalogInfo) bool {
+	items := []ShopItemData{}
+	if sd.Data != nil {
+		items = *sd.Data
+	}
+	cat := NewCatalog(items)
+	c.shopMu.Lock()
+	defer c.shopMu.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	for _, err := range cat.Rejected() {
+		c.log.Printf("catalog: skipped %v", err)
+	}
+	c.shop = sd
+	info.Rejected = len(cat.Rejected())
+	c.shopInfo = info
+	c.catalog = cat
+	return true
+}
+
+// shopFailed marks the catalog in memory stale after a failed refresh
+func (c *Client) shopFailed(err error) {
+	c.shopMu.Lock()
+	defer c.shopMu.Unlock()
+	c.shopInfo.LastError = err
+	c.shopInfo.Stale = true
+}
+
+// CatalogInfo describes the catalog in memory
+func (c *Client) CatalogInfo() CatalogInfo {
+	c.shopMu.RLock()
+	defer c.shopMu.RUnlock()
+	info := c.shopInfo
+	if !info.FetchedAt.IsZero() && c.now().Sub(info.FetchedAt) > c.maxCatalogAge() {
+		info.Stale = true
+	}
+	return info
+}
+
+func (c *Client) saveCatalogCache(sd ShopData, info CatalogInfo) error {
+	if c.cachePath == "" || sd.Data == nil {
+		return nil
+	}
+	raw, err := json.Marshal(catalogCache{
+		Version:   1,
+		BaseURL:   c.baseURL,
+		Namespace: c.namespace,
+		FetchedAt: info.FetchedAt,
+		Region:    info.Region,
+		Items:     *sd.Data,
+	})
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(c.cachePath, raw)
+}
+
+// LoadCachedShop puts the cached catalog in memory, however old it is
+func (c *Client) LoadCachedShop() (CatalogInfo, error) {
+	if c.cachePath == "" {
+		return CatalogInfo{}, errors.New("the catalog cache is off")
+	}
+	raw, err := os.ReadFile(c.cachePath)
+	if err != nil {
+		return CatalogInfo{}, fmt.Errorf("no cached catalog: %w", err)
+	}
+	var cc catalogCache
+	if err := json.Unmarshal(raw, &cc); err != nil || cc.Version != 1 {
+		return CatalogInfo{}, errors.New("the cached catalog is damaged")
+	}
+	if cc.BaseURL != c.baseURL || cc.Namespace != c.namespace {
+		return CatalogInfo{}, errors.New("the cached catalog belongs to another server")
+	}
+	if r := c.Country(); r != "" && cc.Region != "" && cc.Region != r {
+		return CatalogInfo{}, errors.New("the cached catalog is priced for another region")
+	}
+	c.setShop(ShopData{Data: &cc.Items}, CatalogInfo{FetchedAt: cc.FetchedAt, FromCache: true, Region: cc.Region})
+	return c.CatalogInfo(), nil
+}
+
+// cachedShopFresh loads the cache unless the catalog is already in memory, and
+// tells whether it is young enough to skip the download
+func (c *Client) cachedShopFresh() bool {
+	info := c.CatalogInfo()
+	if info.FetchedAt.IsZero() {
+		var err error
+		if info, err = c.LoadCachedShop(); err != nil {
+			return false
+		}
+	}
+	return !info.Stale
+}
+
+// RefreshShopInBackground downloads the catalog without blocking the caller.
+// done, if set, gets the result; a refresh already running is not repeated.
+// Leaving the session cancels the refresh, see stopShopRefresh.
+func (c *Client) RefreshShopInBackground(done func(error)) {
+	c.shopMu.Lock()
+	if c.shopInfo.Refreshing {
+		c.shopMu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.shopInfo.Refreshing = true
+	c.refreshStop = cancel
+	c.shopMu.Unlock()
+
+	go func() {
+		defer cancel()
+		err := c.UpdateShop(ctx)
+		c.shopMu.Lock()
+		// a stopped refresh was already cleared by stopShopRefresh
+		if ctx.Err() == nil {
+			c.shopInfo.Refreshing = false
+			c.refreshStop = nil
+		}
+		c.shopMu.Unlock()
+		if done != nil {
+			done(err)
+		}
+	}()
+}
+
+// stopShopRefresh cancels the background refresh, so a catalog downloaded
+// for a session that is gone does not replace the one of the next
+func (c *Client) stopShopRefresh() {
+	c.shopMu.Lock()
+	defer c.shopMu.Unlock()
+	if c.refreshStop != nil {
+		c.refreshStop()
+		c.refreshStop = nil
+		c.shopInfo.Refreshing = false
+	}
+}
+
+// BrowseOffline drops the session and shows the cached catalog read-only,
+// for when Nebula cannot be reached
+func (c *Client) BrowseOffline() (CatalogInfo, error) {
+	c.tokens.stop()
+	c.stopShopRefresh()
+	c.SetSessionStore(nil)
+	c.setWallets([]WalletData{})
+	c.clearEntitlements()
+	if _, err := c.LoadCachedShop(); err != nil {
+		return CatalogInfo{}, err
+	}
+	c.shopMu.Lock()
+	c.shopInfo.Offline = true
+	c.shopInfo.Stale = true
+	c.shopMu.Unlock()
+	return c.CatalogInfo(), nil
+}
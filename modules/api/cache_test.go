@@ -0,0 +1,74 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestBackgroundRefreshUpdatesCatalog(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.SetCatalog(nebulamock.SyntheticCatalog(150))
+
+	done := make(chan error, 1)
+	c.RefreshShopInBackground(func(err error) { done <- err })
+	if err := <-done; err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if got := c.Catalog().Len(); got != 150 {
+		t.Errorf("%d catalog items after the refresh, want 150", got)
+	}
+	if c.CatalogInfo().Refreshing {
+		t.Error("still refreshing after done")
+	}
+}
+
+func TestBackgroundRefreshDroppedOnLogout(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.SetLatency(nebulamock.RouteCatalog, 200*time.Millisecond)
+
+	done := make(chan error, 1)
+	c.RefreshShopInBackground(func(err error) { done <- err })
+	c.Logout(context.Background())
+	if err := <-done; err == nil {
+		t.Error("the refresh finished after the logout")
+	}
+	if got := c.Catalog().Len(); got != 0 {
+		t.Errorf("%d catalog items after the logout, want none", got)
+	}
+	if c.CatalogInfo().Refreshing {
+		t.Error("still refreshing after the logout")
+	}
+}
+
+func TestBrowseOfflineUsesCache(t *testing.T) {
+	mock, url := startMock(t)
+	cache := filepath.Join(t.TempDir(), "catalog.json")
+	c := api.NewClient(append(fastOptions(), api.WithBaseURL(url), api.WithCatalogCache(cache, time.Hour))...)
+	t.Cleanup(c.Disconnect)
+	if err := c.Init(context.Background(), nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberNothing); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	c.Disconnect()
+	mock.FailNext(nebulamock.RouteCatalog, nebulamock.Failure{Drop: true}, 100)
+
+	info, err := c.BrowseOffline()
+	if err != nil {
+		t.Fatalf("offline failed: %v", err)
+	}
+	if !info.Offline || !info.FromCache {
+		t.Errorf("catalog info %+v, want offline from the cache", info)
+	}
+	if got, want := c.Catalog().Len(), len(nebulamock.DefaultCatalog()); got != want {
+		t.Errorf("%d cached items, want %d", got, want)
+	}
+}
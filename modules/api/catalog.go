@@ -0,0 +1,108 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// CatalogPageSize is how many items GetShop asks for at once
+const CatalogPageSize int = 100
+
+// report the catalog progress every this many items, and after every page
+const catalogProgressStep int = 20
+
+// CatalogProgress is told how many catalog items arrived so far. total is
+// an estimate from the last download, or 0 when there is nothing to go by.
+type CatalogProgress func(loaded int, total int)
+
+type catalogProgressKey struct{}
+
+// WithCatalogProgress returns a context that reports the progress of GetShop calls made with it
+func WithCatalogProgress(ctx context.Context, fn CatalogProgress) context.Context {
+	return context.WithValue(ctx, catalogProgressKey{}, fn)
+}
+
+func notifyCatalogProgress(ctx context.Context, loaded int, total int) {
+	if fn, ok := ctx.Value(catalogProgressKey{}).(CatalogProgress); ok && fn != nil {
+		fn(loaded, total)
+	}
+}
+
+type pagingData struct {
+	Previous *string `json:"previous,omitempty"`
+	Next     *string `json:"next,omitempty"`
+}
+
+// decodeCatalogPage walks a byCriteria page item by item, so a page is never
+// held as raw bytes, and returns the link to the next page if there is one
+func decodeCatalogPage(r io.Reader, onItem func(ShopItemData)) (string, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return "", err
+	}
+	next := ""
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch tok {
+		case "data":
+			if err := expectDelim(dec, '['); err != nil {
+				return "", err
+			}
+			for dec.More() {
+				var item ShopItemData
+				if err := dec.Decode(&item); err != nil {
+					return "", err
+				}
+				onItem(item)
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return "", err
+			}
+		case "paging":
+			var p pagingData
+			if err := dec.Decode(&p); err != nil {
+				return "", err
+			}
+			if p.Next != nil {
+				next = *p.Next
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return "", err
+			}
+		}
+	}
+	return next, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("unexpected %v in the shop response, wanted %v", tok, want)
+	}
+	return nil
+}
+
+// nextPagePath turns a paging link, absolute or not, into a path on the client host
+func nextPagePath(link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return u.RequestURI(), nil
+}
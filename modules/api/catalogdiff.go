@@ -0,0 +1,224 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CatalogDiff lists what changed between two catalog snapshots, matched by ItemId
+type CatalogDiff struct {
+	Added   []ShopItemData
+	Removed []ShopItemData
+	Prices  []PriceChange
+	Status  []StatusChange
+}
+
+// PriceChange is a new price or discount of an item in one region and currency.
+// A zero price on either side means the item was not sold in that currency.
+type PriceChange struct {
+	ItemId        string
+	Sku           string
+	Region        string
+	Currency      string
+	OldPrice      int
+	NewPrice      int
+	OldDiscounted int
+	NewDiscounted int
+}
+
+// StatusChange is a flip of status, purchasable or listable
+type StatusChange struct {
+	ItemId string
+	Sku    string
+	Field  string
+	Old    string
+	New    string
+}
+
+func (d CatalogDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Prices) == 0 && len(d.Status) == 0
+}
+
+// DiffCatalogs compares two snapshots. Items without an ItemId are ignored.
+func DiffCatalogs(older ShopData, newer ShopData) CatalogDiff {
+	before := catalogById(older)
+	after := catalogById(newer)
+	d := CatalogDiff{
+		Added:   []ShopItemData{},
+		Removed: []ShopItemData{},
+		Prices:  []PriceChange{},
+		Status:  []StatusChange{},
+	}
+
+	for id, n := range after {
+		o, ok := before[id]
+		if !ok {
+			d.Added = append(d.Added, n)
+			continue
+		}
+		d.Prices = append(d.Prices, diffPrices(o, n)...)
+		d.Status = append(d.Status, diffStatus(o, n)...)
+	}
+	for id, o := range before {
+		if _, ok := after[id]; !ok {
+			d.Removed = append(d.Removed, o)
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return strOr(d.Added[i].Sku, "") < strOr(d.Added[j].Sku, "") })
+	sort.Slice(d.Removed, func(i, j int) bool { return strOr(d.Removed[i].Sku, "") < strOr(d.Removed[j].Sku, "") })
+	sort.Slice(d.Prices, func(i, j int) bool {
+		a, b := d.Prices[i], d.Prices[j]
+		if a.Sku != b.Sku {
+			return a.Sku < b.Sku
+		}
+		return a.Currency < b.Currency
+	})
+	sort.Slice(d.Status, func(i, j int) bool {
+		a, b := d.Status[i], d.Status[j]
+		if a.Sku != b.Sku {
+			return a.Sku < b.Sku
+		}
+		return a.Field < b.Field
+	})
+	return d
+}
+
+func catalogById(sd ShopData) map[string]ShopItemData {
+	m := map[string]ShopItemData{}
+	if sd.Data == nil {
+		return m
+	}
+	for _, v := range *sd.Data {
+		if v.ItemId != nil {
+			m[*v.ItemId] = v
+		}
+	}
+	return m
+}
+
+type regionPrice struct {
+	price      int
+	discounted int
+}
+
+func regionPrices(item ShopItemData) map[string]regionPrice {
+	m := map[string]regionPrice{}
+	if item.RegionData == nil {
+		return m
+	}
+	for _, rd := range *item.RegionData {
+		if rd.CurrencyCode == nil {
+			continue
+		}
+		m[*rd.CurrencyCode] = regionPrice{price: intOr(rd.Price, 0), discounted: intOr(rd.DiscountedPrice, 0)}
+	}
+	return m
+}
+
+func diffPrices(o ShopItemData, n ShopItemData) []PriceChange {
+	changes := []PriceChange{}
+	before := regionPrices(o)
+	after := regionPrices(n)
+	currencies := map[string]bool{}
+	for k := range before {
+		currencies[k] = true
+	}
+	for k := range after {
+		currencies[k] = true
+	}
+	for cur := range currencies {
+		b, a := before[cur], after[cur]
+		if a == b {
+			continue
+		}
+		changes = append(changes, PriceChange{
+			ItemId:        *n.ItemId,
+			Sku:           strOr(n.Sku, ""),
+			Region:        strOr(n.Region, strOr(o.Region, "")),
+			Currency:      cur,
+			OldPrice:      b.price,
+			NewPrice:      a.price,
+			OldDiscounted: b.discounted,
+			NewDiscounted: a.discounted,
+		})
+	}
+	return changes
+}
+
+func diffStatus(o ShopItemData, n ShopItemData) []StatusChange {
+	changes := []StatusChange{}
+	add := func(field string, was string, now string) {
+		if was != now {
+			changes = append(changes, StatusChange{ItemId: *n.ItemId, Sku: strOr(n.Sku, ""), Field: field, Old: was, New: now})
+		}
+	}
+	add("status", strOr(o.Status, ""), strOr(n.Status, ""))
+	add("purchasable", boolOr(o.Purchasable), boolOr(n.Purchasable))
+	add("listable", boolOr(o.Listable), boolOr(n.Listable))
+	return changes
+}
+
+func strOr(s *string, def string) string {
+	if s == nil {
+		return def
+	}
+	return *s
+}
+
+func intOr(i *int, def int) int {
+	if i == nil {
+		return def
+	}
+	return *i
+}
+
+func boolOr(b *bool) string {
+	if b == nil {
+		return "unset"
+	}
+	return strconv.FormatBool(*b)
+}
+
+// ReadCatalogSnapshot reads a catalog saved either as a cache file or as a raw byCriteria response.
+// The fetch time is zero when the file does not record it.
+func ReadCatalogSnapshot(path string) (ShopData, time.Time, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ShopData{}, time.Time{}, err
+	}
+	var cc catalogCache
+	if json.Unmarshal(raw, &cc) == nil && cc.Version != 0 {
+		return ShopData{Data: &cc.Items}, cc.FetchedAt, nil
+	}
+	var sd ShopData
+	if err := json.Unmarshal(raw, &sd); err != nil || sd.Data == nil {
+		return ShopData{}, time.Time{}, errors.New(path + " is not a catalog snapshot")
+	}
+	return sd, time.Time{}, nil
+}
+
+// CatalogChanges compares the catalog known before this login with the one in memory now.
+// since is when the older catalog was fetched; it is zero when there was none.
+func (c *Client) CatalogChanges() (CatalogDiff, time.Time) {
+	c.shopMu.RLock()
+	base, since := c.baseline, c.baselineAt
+	c.shopMu.RUnlock()
+	if base.Data == nil {
+		return CatalogDiff{}, time.Time{}
+	}
+	return DiffCatalogs(base, ShopData{Data: ptrItems(c.shopItems())}), since
+}
+
+func ptrItems(items []ShopItemData) *[]ShopItemData {
+	return &items
+}
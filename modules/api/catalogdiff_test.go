@@ -0,0 +1,74 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestDiffCatalogs(t *testing.T) {
+	older := []api.ShopItemData{
+		nebulamock.NewItem("pd3_kept", "Kept", "/Cosmetics", "CASH", 1000, 1000),
+		nebulamock.NewItem("pd3_repriced", "Repriced", "/Cosmetics", "CASH", 1000, 1000),
+		nebulamock.NewItem("pd3_gone", "Gone", "/Cosmetics", "CASH", 1000, 1000),
+	}
+	newer := []api.ShopItemData{
+		nebulamock.NewItem("pd3_kept", "Kept", "/Cosmetics", "CASH", 1000, 1000),
+		nebulamock.NewItem("pd3_repriced", "Repriced", "/Cosmetics", "CASH", 1000, 800),
+		nebulamock.NewItem("pd3_new", "New", "/Cosmetics", "CASH", 1000, 1000),
+	}
+	off := false
+	newer[0].Purchasable = &off
+
+	d := api.DiffCatalogs(api.ShopData{Data: &older}, api.ShopData{Data: &newer})
+	if len(d.Added) != 1 || *d.Added[0].Sku != "pd3_new" {
+		t.Errorf("added %v, want pd3_new", d.Added)
+	}
+	if len(d.Removed) != 1 || *d.Removed[0].Sku != "pd3_gone" {
+		t.Errorf("removed %v, want pd3_gone", d.Removed)
+	}
+	want := api.PriceChange{ItemId: nebulamock.MockItemId("pd3_repriced"), Sku: "pd3_repriced", Region: "US", Currency: "CASH",
+		OldPrice: 1000, NewPrice: 1000, OldDiscounted: 1000, NewDiscounted: 800}
+	if len(d.Prices) != 1 || d.Prices[0] != want {
+		t.Errorf("price changes %+v, want %+v", d.Prices, want)
+	}
+	if len(d.Status) != 1 || d.Status[0].Sku != "pd3_kept" || d.Status[0].Field != "purchasable" || d.Status[0].New != "false" {
+		t.Errorf("status changes %+v, want pd3_kept no longer purchasable", d.Status)
+	}
+
+	if !api.DiffCatalogs(api.ShopData{Data: &older}, api.ShopData{Data: &older}).Empty() {
+		t.Error("a catalog differs from itself")
+	}
+}
+
+func TestReadCatalogSnapshot(t *testing.T) {
+	items := nebulamock.DefaultCatalog()
+	raw, err := json.Marshal(api.ShopData{Data: &items})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "byCriteria.json")
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sd, fetched, err := api.ReadCatalogSnapshot(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(*sd.Data) != len(items) {
+		t.Errorf("%d items read, want %d", len(*sd.Data), len(items))
+	}
+	if !fetched.IsZero() {
+		t.Errorf("fetch time %v for a raw response, want none", fetched)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultBaseURL   string        = "https://nebula.starbreeze.com"
+	DefaultNamespace string        = "pd3"
+	DefaultClientID  string        = "d682bcf949cb4744b3cd4295bbdd9fef"
+	DefaultTimeout   time.Duration = 30 * time.Second
+)
+
+// Client holds a single Nebula session together with the shop catalog
+// and wallet state that belong to it.
+type Client struct {
+	baseURL   string
+	namespace string
+	clientID  string
+	http      *http.Client
+	timeout   time.Duration
+	retry     RetryPolicy
+	limiter   *limiter
+	now       func() time.Time
+	log       *log.Logger
+	// Nebula clock minus ours, from the Date header of the last response
+	clockOffset atomic.Int64
+
+	tokens  *tokenManager
+	store   SessionStore
+	storeMu sync.Mutex
+
+	// shop is replaced as a whole under shopMu, never changed in place, read through Shop
+	shopMu      sync.RWMutex
+	shopInfo    CatalogInfo
+	catalog     *Catalog
+	cachePath   string
+	cacheMaxAge time.Duration
+	// cancels the background refresh, see RefreshShopInBackground
+	refreshStop context.CancelFunc
+	// catalog known before the current login, for CatalogChanges
+	baseline   ShopData
+	baselineAt time.Time
+	shop       ShopData
+
+	// replaced as a whole under walletMu by UpdateWallets, read through Wallets
+	walletMu sync.RWMutex
+	wallets  []WalletData
+
+	// ordered quantities per item id, from the entitlements and the orders placed since;
+	// the entitlements are read through Entitlements
+	ownedMu      sync.Mutex
+	owned        map[string]int
+	entitlements []EntitlementData
+}
+
+type Option func(*Client)
+
+// WithBaseURL points the client at a different Nebula host (e.g. a local stand-in server)
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+func WithNamespace(ns string) Option {
+	return func(c *Client) {
+		c.namespace = ns
+	}
+}
+
+func WithClientID(id string) Option {
+	return func(c *Client) {
+		c.clientID = id
+	}
+}
+
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithTimeout bounds every request that does not already carry a deadline in its context
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithLogger sets where the client reports things it skipped, like catalog items it could not use
+func WithLogger(l *log.Logger) Option {
+	return func(c *Client) {
+		c.log = l
+	}
+}
+
+// WithClock replaces time.Now for token bookkeeping
+func WithClock(now func() time.Time) Option {
+	return func(c *Client) {
+		c.now = now
+	}
+}
+
+// noteServerTime keeps the offset of the Nebula clock. The Date header has a
+// resolution of one second, so smaller offsets are taken as no offset at all.
+func (c *Client) noteServerTime(h http.Header) {
+	t, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		return
+	}
+	offset := t.Sub(c.now())
+	if offset > -2*time.Second && offset < 2*time.Second {
+		offset = 0
+	}
+	c.clockOffset.Store(int64(offset))
+}
+
+// ServerNow estimates the current time on Nebula, for sale and discount windows
+func (c *Client) ServerNow() time.Time {
+	return c.now().Add(time.Duration(c.clockOffset.Load()))
+}
+
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		baseURL:      DefaultBaseURL,
+		namespace:    DefaultNamespace,
+		clientID:     DefaultClientID,
+		http:         &http.Client{},
+		timeout:      DefaultTimeout,
+		retry:        DefaultRetryPolicy,
+		now:          time.Now,
+		log:          log.New(io.Discard, "", 0),
+		wallets:      []WalletData{},
+		owned:        map[string]int{},
+		entitlements: []EntitlementData{},
+	}
+	c.tokens = &tokenManager{c: c}
+	c.limiter = newLimiter(DefaultRateLimit, func() time.Time { return c.now() })
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// nsPath prefixes a public platform path with the client namespace
+func (c *Client) nsPath(format string, a ...any) string {
+	return fmt.Sprintf("/platform/public/namespaces/%s", c.namespace) + fmt.Sprintf(format, a...)
+}
+
+// apicall sends the request within the client rate limit, repeating it according to the retry policy
+func (c *Client) apicall(ctx context.Context, path string, method string, headers []header, body string, consume func(io.Reader) error) ([]byte, int, http.Header, error) {
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return []byte{}, 0, nil, err
+		}
+		resBody, status, hdr, err := c.send(ctx, path, method, headers, body, consume)
+		c.limiter.Feedback(status, err)
+		if attempt >= c.retry.MaxAttempts || !c.retry.shouldRetry(method, status, err) {
+			return resBody, status, hdr, err
+		}
+		wait, ok := c.retry.backoff(attempt, hdr, c.now())
+		if !ok {
+			return resBody, status, hdr, err
+		}
+		notifyRetry(ctx, RetryInfo{Attempt: attempt, MaxAttempts: c.retry.MaxAttempts, Wait: wait, Status: status, Err: err})
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return resBody, status, hdr, err
+		}
+	}
+}
+
+// request is apicall for callers expecting a single success status.
+// Anything else comes back as one of the typed errors from errors.go.
+func (c *Client) request(ctx context.Context, path string, method string, headers []header, body string, want int) ([]byte, error) {
+	return c.stream(ctx, path, method, headers, body, want, nil)
+}
+
+// stream is request with the successful body handed to consume as it arrives instead of
+// being read into memory. consume runs again on a retry, so it must start over each time.
+func (c *Client) stream(ctx context.Context, path string, method string, headers []header, body string, want int, consume func(io.Reader) error) ([]byte, error) {
+	authed := true
+	for _, h := range headers {
+		if h.Key == "Authorization" {
+			authed = false
+		}
+	}
+	if authed {
+		if err := c.tokens.ensureFresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	sent := c.tokens.session().Token
+	raw, status, hdr, err := c.apicall(ctx, path, method, headers, body, consume)
+	if authed && err == nil && status == http.StatusUnauthorized && c.tokens.isActive() {
+		// the token died early, renew it once and repeat
+		if c.tokens.refresh(ctx, sent) == nil {
+			raw, status, hdr, err = c.apicall(ctx, path, method, headers, body, consume)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if method != http.MethodGet && !dialFailed(err) {
+			// sent, but the answer was lost or timed out
+			return nil, &UnknownOutcomeError{APIError{Message: "no answer from Nebula, the request may or may not have gone through: " + err.Error()}}
+		}
+		return nil, &NetworkError{Err: err}
+	}
+	if status != want {
+		if method != http.MethodGet && (status == http.StatusBadGateway || status == http.StatusGatewayTimeout) {
+			return nil, &UnknownOutcomeError{APIError{Status: status, Message: "no answer from Nebula, the request may or may not have gone through"}}
+		}
+		return nil, parseAPIError(status, raw, hdr, c.now())
+	}
+	return raw, nil
+}
+
+// send performs a single attempt, bounded by the client timeout unless ctx has its own deadline.
+// A 2xx body goes to consume when it is set; its failure counts as a broken transfer.
+func (c *Client) send(ctx context.Context, path string, method string, headers []header, body string, consume func(io.Reader) error) ([]byte, int, http.Header, error) {
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, strings.NewReader(body))
+	if err != nil {
+		return []byte{}, 0, nil, err
+	}
+
+	// Main Headers
+	for _, v := range headers {
+		req.Header.Set(v.Key, v.Value)
+	}
+
+	// Stealth
+	for _, v := range stealth_headers {
+		req.Header.Set(v.Key, v.Value)
+	}
+	req.Header.Set("Namespace", c.namespace)
+
+	// Postlogin auth headers, unless the caller authenticates on its own
+	if ld := c.tokens.session(); ld.Token != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", ld.TokenType+" "+ld.Token)
+		req.Header.Set("Cookie", fmt.Sprintf("access_token=%s; refresh_token=%s", ld.Token, ld.RefreshToken))
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return []byte{}, 0, nil, err
+	}
+	defer res.Body.Close()
+	c.noteServerTime(res.Header)
+
+	if consume != nil && res.StatusCode >= 200 && res.StatusCode < 300 {
+		if err := consume(res.Body); err != nil {
+			return []byte{}, 0, res.Header, err
+		}
+		return []byte{}, res.StatusCode, res.Header, nil
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return []byte{}, 0, res.Header, err
+	}
+
+	return resBody, res.StatusCode, res.Header, nil
+}
@@ -0,0 +1,75 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"payshop3/api"
+)
+
+// fakeNebula answers the login, catalog and wallet requests of one user with a CASH balance
+func fakeNebula(t *testing.T, userId string, cash int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/iam/v3/oauth/token":
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "token-" + userId, "token_type": "Bearer", "user_id": userId})
+		case strings.HasSuffix(r.URL.Path, "/items/byCriteria"):
+			json.NewEncoder(w).Encode(map[string]any{"data": []any{}})
+		case strings.Contains(r.URL.Path, "/users/"+userId+"/wallets/"):
+			if r.Header.Get("Authorization") != "Bearer token-"+userId {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			code := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			json.NewEncoder(w).Encode(map[string]any{"currencyCode": code, "balance": cash})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestNewClientOptions(t *testing.T) {
+	if got := api.NewClient().Namespace(); got != api.DefaultNamespace {
+		t.Errorf("namespace %q, want %q", got, api.DefaultNamespace)
+	}
+	if got := api.NewClient(api.WithNamespace("pd3test")).Namespace(); got != "pd3test" {
+		t.Errorf("namespace %q, want pd3test", got)
+	}
+}
+
+// two clients must not share a session or wallets, as the package globals did
+func TestClientsKeepSeparateSessions(t *testing.T) {
+	a := newClient(t, fakeNebula(t, "alice", 100))
+	b := newClient(t, fakeNebula(t, "bob", 200))
+	for _, c := range []*api.Client{a, b} {
+		if err := c.Init(context.Background(), "login", "password", api.RememberNothing); err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+	}
+
+	for c, want := range map[*api.Client]int{a: 100, b: 200} {
+		w, err := c.GetCachedWalletByCode("CASH")
+		if err != nil {
+			t.Fatalf("no CASH wallet: %v", err)
+		}
+		if *w.Balance != want {
+			t.Errorf("CASH balance %d, want %d", *w.Balance, want)
+		}
+	}
+	if a.Session().UserId == b.Session().UserId {
+		t.Error("both clients ended up with the same session")
+	}
+}
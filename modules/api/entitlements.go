@@ -0,0 +1,141 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const EntitlementPageSize int = 100
+
+type entitlementPage struct {
+	Data   []EntitlementData `json:"data"`
+	Paging pagingData        `json:"paging"`
+}
+
+// GetEntitlements downloads every active entitlement of the user, page by page
+func (c *Client) GetEntitlements(ctx context.Context) ([]EntitlementData, error) {
+	ents := []EntitlementData{}
+	path := c.nsPath("/users/%s/entitlements?activeOnly=true&offset=0&limit=%d", c.Session().UserId, EntitlementPageSize)
+	seen := map[string]bool{}
+	for path != "" && !seen[path] {
+		seen[path] = true
+		raw, err := c.request(ctx, path, "GET", []header{}, "", 200)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query entitlements: %w", err)
+		}
+		var page entitlementPage
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, errors.New("failed to parse entitlements response")
+		}
+		ents = append(ents, page.Data...)
+		if len(page.Data) == 0 || page.Paging.Next == nil {
+			break
+		}
+		path, err = nextPagePath(*page.Paging.Next)
+		if err != nil {
+			return nil, errors.New("failed to parse entitlements response")
+		}
+	}
+	return ents, nil
+}
+
+// UpdateEntitlements reloads the entitlements and the owned quantities counted from them
+func (c *Client) UpdateEntitlements(ctx context.Context) error {
+	ents, err := c.GetEntitlements(ctx)
+	if err != nil {
+		return err
+	}
+	owned := map[string]int{}
+	for _, e := range ents {
+		if e.ItemId == nil || strOr(e.Status, "ACTIVE") != "ACTIVE" {
+			continue
+		}
+		owned[*e.ItemId] += entitlementQuantity(e)
+	}
+	c.ownedMu.Lock()
+	c.owned = owned
+	c.entitlements = ents
+	c.ownedMu.Unlock()
+	return nil
+}
+
+func (c *Client) clearEntitlements() {
+	c.ownedMu.Lock()
+	c.owned = map[string]int{}
+	c.entitlements = []EntitlementData{}
+	c.ownedMu.Unlock()
+}
+
+// Entitlements returns a copy of the entitlements loaded by UpdateEntitlements
+func (c *Client) Entitlements() []EntitlementData {
+	c.ownedMu.Lock()
+	defer c.ownedMu.Unlock()
+	ents := make([]EntitlementData, len(c.entitlements))
+	copy(ents, c.entitlements)
+	return ents
+}
+
+// entitlementQuantity is how many purchases of the item an entitlement stands for
+func entitlementQuantity(e EntitlementData) int {
+	for _, q := range []*int{e.StackedQuantity, e.Quantity} {
+		if q != nil && *q > 0 {
+			return *q
+		}
+	}
+	return 1
+}
+
+// Owned is the quantity of the item the user already has
+func (c *Client) Owned(itemId string) int {
+	c.ownedMu.Lock()
+	defer c.ownedMu.Unlock()
+	return c.owned[itemId]
+}
+
+func (c *Client) noteOwned(itemId string, quantity int) {
+	c.ownedMu.Lock()
+	c.owned[itemId] += quantity
+	c.ownedMu.Unlock()
+}
+
+// Limit is how many more units of an item can be ordered
+type Limit struct {
+	// -1 when there is no limit
+	Left int
+	// what the limit comes from, empty without one
+	Reason string
+}
+
+// LimitFor applies MaxCountPerUser to what the user owns plus inCart units
+// waiting in the cart, and MaxCount to the cart alone
+func (c *Client) LimitFor(it Item, inCart int) Limit {
+	lim := Limit{Left: -1}
+	// Left alone cannot tell, it is also -1 for a cart over the limit
+	limited := false
+	if it.MaxCount >= 0 {
+		lim = Limit{Left: it.MaxCount - inCart, Reason: fmt.Sprintf("only %d for sale", it.MaxCount)}
+		limited = true
+	}
+	if it.MaxCountPerUser >= 0 {
+		owned := c.Owned(it.Id)
+		left := it.MaxCountPerUser - owned - inCart
+		if !limited || left < lim.Left {
+			lim = Limit{Left: left, Reason: fmt.Sprintf("%d per account, %d owned", it.MaxCountPerUser, owned)}
+		}
+		limited = true
+	}
+	if limited && lim.Left < 0 {
+		lim.Left = 0
+	}
+	if inCart > 0 && lim.Reason != "" {
+		lim.Reason += fmt.Sprintf(", %d in the cart", inCart)
+	}
+	return lim
+}
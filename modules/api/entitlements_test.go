@@ -0,0 +1,117 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+// limitedCatalog is the default catalog with limits on the ammo bag
+func limitedCatalog(maxCount int, maxPerUser int) []api.ShopItemData {
+	items := nebulamock.DefaultCatalog()
+	for i := range items {
+		if *items[i].Sku == ammo_bag {
+			items[i].MaxCount = &maxCount
+			items[i].MaxCountPerUser = &maxPerUser
+		}
+	}
+	return items
+}
+
+func TestEntitlementPaging(t *testing.T) {
+	grants := 2*api.EntitlementPageSize + 3
+	id := nebulamock.MockItemId(ammo_bag)
+	_, c := loggedIn(t, func(m *nebulamock.Server) {
+		for i := 0; i < grants; i++ {
+			m.Grant(nebulamock.DefaultUserId, id, 1)
+		}
+	})
+
+	if got := len(c.Entitlements()); got != grants {
+		t.Errorf("%d entitlements loaded, want %d", got, grants)
+	}
+	if got := c.Owned(id); got != grants {
+		t.Errorf("%d owned, want %d", got, grants)
+	}
+}
+
+func TestLimitFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxCount   int
+		maxPerUser int
+		owned      int
+		inCart     int
+		left       int
+		reason     string
+	}{
+		{"no limit", -1, -1, 0, 5, -1, ""},
+		{"for sale", 3, -1, 0, 1, 2, "only 3 for sale, 1 in the cart"},
+		{"per account", -1, 4, 1, 1, 2, "4 per account, 1 owned, 1 in the cart"},
+		{"per account used up", -1, 2, 2, 0, 0, "2 per account, 2 owned"},
+		{"tighter of both", 10, 4, 1, 0, 3, "4 per account, 1 owned"},
+		// the sale limit must stay when the cart is over it already
+		{"cart over the sale limit", 3, 10, 0, 5, 0, "only 3 for sale, 5 in the cart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, c := loggedIn(t, func(m *nebulamock.Server) {
+				m.SetCatalog(limitedCatalog(tt.maxCount, tt.maxPerUser))
+				if tt.owned > 0 {
+					m.Grant(nebulamock.DefaultUserId, nebulamock.MockItemId(ammo_bag), tt.owned)
+				}
+			})
+			lim := c.LimitFor(mustItem(t, c, ammo_bag), tt.inCart)
+			if lim.Left != tt.left || lim.Reason != tt.reason {
+				t.Errorf("got %d %q, want %d %q", lim.Left, lim.Reason, tt.left, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExecOrderOverLimit(t *testing.T) {
+	mock, c := loggedIn(t, func(m *nebulamock.Server) {
+		m.SetCatalog(limitedCatalog(-1, 2))
+		m.Grant(nebulamock.DefaultUserId, nebulamock.MockItemId(ammo_bag), 1)
+	})
+	ctx := context.Background()
+
+	// refused before anything is sent
+	_, err := c.ExecOrder(ctx, orderLine(t, c, ammo_bag, "CASH", 2))
+	var le *api.LimitExceededError
+	if !errors.As(err, &le) {
+		t.Fatalf("got %v, want a LimitExceededError", err)
+	}
+	if got := mock.Hits(nebulamock.RouteOrders); got != 0 {
+		t.Errorf("%d order requests, want none", got)
+	}
+
+	if _, err := c.ExecOrder(ctx, orderLine(t, c, ammo_bag, "CASH", 1)); err != nil {
+		t.Fatalf("order within the limit failed: %v", err)
+	}
+	// counted locally since the last order, Nebula is not asked again
+	if lim := c.LimitFor(mustItem(t, c, ammo_bag), 0); lim.Left != 0 {
+		t.Errorf("%d left after reaching the limit, want 0", lim.Left)
+	}
+}
+
+func TestLimitEnforcedByNebula(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	line := orderLine(t, c, ammo_bag, "CASH", 3)
+	// the limit appears after the catalog was loaded
+	mock.SetCatalog(limitedCatalog(2, -1))
+
+	_, err := c.ExecOrder(context.Background(), line)
+	var le *api.LimitExceededError
+	if !errors.As(err, &le) {
+		t.Fatalf("got %v, want a LimitExceededError", err)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Nebula (AccelByte) error codes payshop3 reacts to
+const (
+	ErrCodeUnauthorized        int = 20001
+	ErrCodeValidation          int = 20002
+	ErrCodeTooManyRequests     int = 20007
+	ErrCodeNotFound            int = 20008
+	ErrCodeForbidden           int = 20013
+	ErrCodeItemNotFound        int = 30341
+	ErrCodeItemSkuNotFound     int = 30343
+	ErrCodePriceMismatch       int = 32121
+	ErrCodeItemTypeUnsupported int = 32122
+	ErrCodeItemNotPurchasable  int = 32123
+	ErrCodeMaxCountPerUser     int = 32175
+	ErrCodeMaxCount            int = 32176
+	ErrCodeInsufficientBalance int = 35123
+	ErrCodeWalletInactive      int = 35124
+	ErrCodeWalletNotFound      int = 35141
+)
+
+// APIError is a non-successful Nebula response. The more specific error
+// types below embed it, so errors.As works for both the class and the details.
+type APIError struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Code != 0 {
+		return fmt.Sprintf("%s (code %d)", msg, e.Code)
+	}
+	return msg
+}
+
+// AuthError means the credentials or session were rejected
+type AuthError struct{ APIError }
+
+// RateLimitError means Nebula throttled the request; RetryAfter is zero when no hint was given
+type RateLimitError struct {
+	APIError
+	RetryAfter time.Duration
+}
+
+type InsufficientBalanceError struct{ APIError }
+
+// ItemUnavailableError covers items that do not exist or cannot be bought
+type ItemUnavailableError struct{ APIError }
+
+// PriceMismatchError means the cart price no longer matches the shop
+type PriceMismatchError struct{ APIError }
+
+// LimitExceededError means the order goes over MaxCount or MaxCountPerUser
+type LimitExceededError struct{ APIError }
+
+type ServerError struct{ APIError }
+
+// UnknownOutcomeError means a gateway failed or the answer was lost while a
+// request that changes something, like an order, was on its way. Nebula may
+// have processed it, so it is not repeated and the user has to check whether
+// it went through.
+type UnknownOutcomeError struct{ APIError }
+
+// MFARequiredError means the password was right, but the account wants a second factor.
+// Hand it to VerifyMFA together with the code to finish the login.
+type MFARequiredError struct {
+	APIError
+	Token         string
+	Factors       []string
+	DefaultFactor string
+
+	// what the login was started with
+	login    string
+	password string
+	remember Remember
+}
+
+// NetworkError wraps transport failures where no response was received
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("could not reach Nebula: %s", e.Err.Error())
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// oauthErrorData is the IAM flavour of an error body
+type oauthErrorData struct {
+	Error            *string  `json:"error,omitempty"`
+	ErrorDescription *string  `json:"error_description,omitempty"`
+	MFAToken         string   `json:"mfa_token,omitempty"`
+	Factors          []string `json:"factors,omitempty"`
+	DefaultFactor    string   `json:"default_factor,omitempty"`
+}
+
+// parseAPIError classifies an error response by its error code first and HTTP status second
+func parseAPIError(status int, body []byte, h http.Header, now time.Time) error {
+	base := APIError{Status: status}
+
+	var ed OrderErrorData
+	if json.Unmarshal(body, &ed) == nil {
+		if ed.ErrorCode != nil {
+			base.Code = *ed.ErrorCode
+		}
+		if ed.ErrorMessage != nil {
+			base.Message = *ed.ErrorMessage
+		}
+	}
+	oauthKind := ""
+	var oe oauthErrorData
+	if base.Message == "" {
+		if json.Unmarshal(body, &oe) == nil && oe.Error != nil {
+			oauthKind = *oe.Error
+			base.Message = *oe.Error
+			if oe.ErrorDescription != nil && *oe.ErrorDescription != "" {
+				base.Message = *oe.ErrorDescription
+			}
+		}
+	}
+
+	switch base.Code {
+	case ErrCodeUnauthorized, ErrCodeForbidden:
+		return &AuthError{base}
+	case ErrCodeTooManyRequests:
+		d, _ := retryAfter(h, now)
+		return &RateLimitError{APIError: base, RetryAfter: d}
+	case ErrCodeInsufficientBalance, ErrCodeWalletInactive, ErrCodeWalletNotFound:
+		return &InsufficientBalanceError{base}
+	case ErrCodeItemNotFound, ErrCodeItemSkuNotFound, ErrCodeItemNotPurchasable, ErrCodeItemTypeUnsupported:
+		return &ItemUnavailableError{base}
+	case ErrCodePriceMismatch:
+		return &PriceMismatchError{base}
+	case ErrCodeMaxCount, ErrCodeMaxCountPerUser:
+		return &LimitExceededError{base}
+	}
+
+	switch oauthKind {
+	case "mfa_required":
+		return &MFARequiredError{APIError: base, Token: oe.MFAToken, Factors: oe.Factors, DefaultFactor: oe.DefaultFactor}
+	case "invalid_grant", "invalid_client", "unauthorized_client", "access_denied", "invalid_token":
+		return &AuthError{base}
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return &AuthError{base}
+	case status == http.StatusTooManyRequests:
+		d, _ := retryAfter(h, now)
+		return &RateLimitError{APIError: base, RetryAfter: d}
+	case status >= 500:
+		return &ServerError{base}
+	}
+	return &base
+}
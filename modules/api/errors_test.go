@@ -0,0 +1,97 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+// the order errors the checkout tells apart, each scripted on the stand-in
+func TestOrderErrorsAreTyped(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(mock *nebulamock.Server, line *api.OrderInitData)
+		check func(err error) bool
+	}{
+		{"insufficient balance", func(mock *nebulamock.Server, line *api.OrderInitData) {
+			mock.SetBalance(nebulamock.DefaultUserId, "CASH", 10)
+		}, func(err error) bool {
+			var e *api.InsufficientBalanceError
+			return errors.As(err, &e)
+		}},
+		{"price mismatch", func(mock *nebulamock.Server, line *api.OrderInitData) {
+			line.DiscountedPrice--
+		}, func(err error) bool {
+			var e *api.PriceMismatchError
+			return errors.As(err, &e)
+		}},
+		{"item gone from the store", func(mock *nebulamock.Server, line *api.OrderInitData) {
+			mock.SetCatalog([]api.ShopItemData{})
+		}, func(err error) bool {
+			var e *api.ItemUnavailableError
+			return errors.As(err, &e)
+		}},
+		{"rate limited", func(mock *nebulamock.Server, line *api.OrderInitData) {
+			mock.FailNext(nebulamock.RouteOrders, nebulamock.Failure{Status: 429, ErrorCode: api.ErrCodeTooManyRequests}, 4)
+		}, func(err error) bool {
+			var e *api.RateLimitError
+			return errors.As(err, &e)
+		}},
+		{"session revoked", func(mock *nebulamock.Server, line *api.OrderInitData) {
+			mock.FailNext(nebulamock.RouteOrders, nebulamock.Failure{Status: 403, ErrorCode: api.ErrCodeForbidden}, 1)
+		}, func(err error) bool {
+			var e *api.AuthError
+			return errors.As(err, &e)
+		}},
+		{"no answer", func(mock *nebulamock.Server, line *api.OrderInitData) {
+			mock.FailNext(nebulamock.RouteOrders, nebulamock.Failure{Drop: true}, 1)
+		}, func(err error) bool {
+			var e *api.UnknownOutcomeError
+			return errors.As(err, &e)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, c := loggedIn(t, nil)
+			line := orderLine(t, c, ammo_bag, "CASH", 1)
+			tt.setup(mock, &line)
+
+			_, err := c.ExecOrder(context.Background(), line)
+			if !tt.check(err) {
+				t.Errorf("got %T %v", err, err)
+			}
+		})
+	}
+}
+
+func TestUnknownItemRefusedLocally(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+
+	_, err := c.ExecOrder(context.Background(), api.OrderInitData{ItemId: "nope", Quantity: 1})
+	var e *api.ItemUnavailableError
+	if !errors.As(err, &e) {
+		t.Fatalf("got %v, want an ItemUnavailableError", err)
+	}
+	if got := mock.Hits(nebulamock.RouteOrders); got != 0 {
+		t.Errorf("%d order requests, want none", got)
+	}
+}
+
+func TestDroppedGetIsNetworkError(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.FailNext(nebulamock.RouteWallet, nebulamock.Failure{Drop: true}, 100)
+
+	err := c.UpdateWallets(context.Background())
+	var ne *api.NetworkError
+	if !errors.As(err, &ne) {
+		t.Errorf("got %v, want a NetworkError", err)
+	}
+}
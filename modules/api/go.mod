@@ -2,4 +2,9 @@ module payshop3/api
 
 go 1.20
 
-require github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
+require (
+	github.com/golang-jwt/jwt v3.2.2+incompatible
+	golang.org/x/crypto v0.14.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,146 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+const preplanningCategory string = "/PreplanningAssets"
+
+// Catalog is a read-only view of the shop items, validated and indexed once per
+// shop load. Lookups never walk the item list and only see items that passed ToItem.
+type Catalog struct {
+	raw        []ShopItemData
+	items      []Item
+	rejected   []*ItemError
+	byId       map[string]int
+	bySku      map[string]int
+	byCategory map[string][]int
+	byTag      map[string][]int
+	byTarget   map[string][]int
+	assetBank  []AssetGroupData
+	assetGroup map[string]int
+}
+
+// NewCatalog validates and indexes raw. The slice is kept as is and must not be changed afterwards.
+func NewCatalog(raw []ShopItemData) *Catalog {
+	items, rejected := ValidateItems(raw)
+	cat := &Catalog{
+		raw:        raw,
+		items:      items,
+		rejected:   rejected,
+		byId:       make(map[string]int, len(items)),
+		bySku:      make(map[string]int, len(items)),
+		byCategory: map[string][]int{},
+		byTag:      map[string][]int{},
+		byTarget:   map[string][]int{},
+		assetBank:  []AssetGroupData{},
+		assetGroup: map[string]int{},
+	}
+	for i, v := range items {
+		cat.byId[v.Id] = i
+		if _, dup := cat.bySku[v.Sku]; !dup {
+			cat.bySku[v.Sku] = i
+		}
+		cat.byCategory[v.CategoryPath] = append(cat.byCategory[v.CategoryPath], i)
+		for _, t := range v.Tags {
+			cat.byTag[t] = append(cat.byTag[t], i)
+		}
+		if v.TargetCurrencyCode != "" {
+			cat.byTarget[v.TargetCurrencyCode] = append(cat.byTarget[v.TargetCurrencyCode], i)
+		}
+	}
+	cat.buildAssetBank()
+	return cat
+}
+
+// buildAssetBank groups the preplanning assets by the heist in their SKU.
+// ToItem has already rejected the assets whose SKU does not parse.
+func (cat *Catalog) buildAssetBank() {
+	for _, i := range cat.byCategory[preplanningCategory] {
+		v := cat.items[i]
+		sku, err := ParseSKU(v.Sku)
+		if err != nil {
+			continue
+		}
+		g, ok := cat.assetGroup[sku.Group]
+		if !ok {
+			g = len(cat.assetBank)
+			cat.assetGroup[sku.Group] = g
+			cat.assetBank = append(cat.assetBank, AssetGroupData{Sku: sku.Group, Items: []Item{}})
+		}
+		cat.assetBank[g].Items = append(cat.assetBank[g].Items, v)
+	}
+}
+
+// Rejected lists the catalog entries that failed validation, with the reasons
+func (cat *Catalog) Rejected() []*ItemError {
+	return cat.rejected
+}
+
+func (cat *Catalog) pick(idx []int) []Item {
+	arr := make([]Item, 0, len(idx))
+	for _, i := range idx {
+		arr = append(arr, cat.items[i])
+	}
+	return arr
+}
+
+// Raw returns every catalog entry as downloaded, rejected ones included
+func (cat *Catalog) Raw() []ShopItemData {
+	return cat.raw
+}
+
+// Items returns the valid items in catalog order
+func (cat *Catalog) Items() []Item {
+	return cat.items
+}
+
+func (cat *Catalog) Len() int {
+	return len(cat.items)
+}
+
+func (cat *Catalog) ById(id string) (Item, bool) {
+	i, ok := cat.byId[id]
+	if !ok {
+		return Item{}, false
+	}
+	return cat.items[i], true
+}
+
+// BySku returns the first item with the given SKU
+func (cat *Catalog) BySku(sku string) (Item, bool) {
+	i, ok := cat.bySku[sku]
+	if !ok {
+		return Item{}, false
+	}
+	return cat.items[i], true
+}
+
+func (cat *Catalog) InCategory(path string) []Item {
+	return cat.pick(cat.byCategory[path])
+}
+
+func (cat *Catalog) WithTag(tag string) []Item {
+	return cat.pick(cat.byTag[tag])
+}
+
+// ForTargetCurrency returns the items that top up the given currency, like credit packs
+func (cat *Catalog) ForTargetCurrency(code string) []Item {
+	return cat.pick(cat.byTarget[code])
+}
+
+// AssetBank returns the preplanning assets grouped by heist, in catalog order
+func (cat *Catalog) AssetBank() []AssetGroupData {
+	agd := make([]AssetGroupData, len(cat.assetBank))
+	copy(agd, cat.assetBank)
+	return agd
+}
+
+func (cat *Catalog) AssetGroup(sku string) (AssetGroupData, bool) {
+	g, ok := cat.assetGroup[sku]
+	if !ok {
+		return AssetGroupData{}, false
+	}
+	return cat.assetBank[g], true
+}
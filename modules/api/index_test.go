@@ -0,0 +1,236 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"strings"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestCatalogIndex(t *testing.T) {
+	items := nebulamock.SyntheticCatalog(500)
+	cat := api.NewCatalog(items)
+	if cat.Len() != len(items) {
+		t.Fatalf("%d items indexed, want %d", cat.Len(), len(items))
+	}
+
+	for _, v := range items {
+		if got, ok := cat.ById(*v.ItemId); !ok || got.Sku != *v.Sku {
+			t.Fatalf("ById(%s) = %v, %v", *v.ItemId, got.Sku, ok)
+		}
+		if got, ok := cat.BySku(*v.Sku); !ok || got.Id != *v.ItemId {
+			t.Fatalf("BySku(%s) = %v, %v", *v.Sku, got.Id, ok)
+		}
+	}
+	if _, ok := cat.ById("nope"); ok {
+		t.Error("found an item that is not there")
+	}
+
+	counts := map[string]int{}
+	for _, v := range items {
+		counts[*v.CategoryPath]++
+	}
+	for path, n := range counts {
+		if got := len(cat.InCategory(path)); got != n {
+			t.Errorf("%d items in %s, want %d", got, path, n)
+		}
+	}
+	if got := len(cat.WithTag("tag1")); got == 0 {
+		t.Error("no items tagged tag1")
+	}
+	for _, v := range cat.ForTargetCurrency("CRED") {
+		if v.TargetCurrencyCode != "CRED" {
+			t.Errorf("%s does not top up CRED", v.Sku)
+		}
+	}
+}
+
+func TestCatalogAssetBank(t *testing.T) {
+	cat := api.NewCatalog(nebulamock.SyntheticCatalog(500))
+
+	bank := cat.AssetBank()
+	if len(bank) == 0 {
+		t.Fatal("no preplanning assets grouped")
+	}
+	for _, g := range bank {
+		got, ok := cat.AssetGroup(g.Sku)
+		if !ok || len(got.Items) != len(g.Items) {
+			t.Errorf("AssetGroup(%s) has %d assets, want %d", g.Sku, len(got.Items), len(g.Items))
+		}
+		for _, v := range g.Items {
+			if v.CategoryPath != "/PreplanningAssets" {
+				t.Errorf("%s in the asset bank is not a preplanning asset", v.Sku)
+			}
+		}
+	}
+	g, ok := cat.AssetGroup("synth0")
+	if !ok || len(g.Items) != 4 {
+		t.Errorf("synth0 has %d assets, want 4", len(g.Items))
+	}
+}
+
+// size of the synthetic catalog the lookups are timed on
+const bench_items int = 20000
+
+// benchCatalog builds the catalog and picks the last item and asset group, the worst case for a scan
+func benchCatalog(b *testing.B) ([]api.ShopItemData, *api.Catalog, api.ShopItemData, string) {
+	b.Helper()
+	items := nebulamock.SyntheticCatalog(bench_items)
+	cat := api.NewCatalog(items)
+	bank := cat.AssetBank()
+	if len(bank) == 0 {
+		b.Fatal("the synthetic catalog has no preplanning assets")
+	}
+	b.ResetTimer()
+	return items, cat, items[len(items)-1], bank[len(bank)-1].Sku
+}
+
+func BenchmarkNewCatalog(b *testing.B) {
+	items, _, _, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		api.NewCatalog(items)
+	}
+}
+
+func BenchmarkCatalogById(b *testing.B) {
+	_, cat, last, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		cat.ById(*last.ItemId)
+	}
+}
+
+func BenchmarkCatalogBySku(b *testing.B) {
+	_, cat, last, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		cat.BySku(*last.Sku)
+	}
+}
+
+func BenchmarkCatalogAssetBank(b *testing.B) {
+	_, cat, _, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		cat.AssetBank()
+	}
+}
+
+func BenchmarkCatalogAssetGroup(b *testing.B) {
+	_, cat, _, group := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		cat.AssetGroup(group)
+	}
+}
+
+func BenchmarkCatalogForTargetCurrency(b *testing.B) {
+	_, cat, _, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		cat.ForTargetCurrency("CRED")
+	}
+}
+
+// The scans below are the lookups the client did before the catalog was indexed
+
+func BenchmarkScanById(b *testing.B) {
+	items, _, last, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		scanById(items, *last.ItemId)
+	}
+}
+
+func BenchmarkScanBySku(b *testing.B) {
+	items, _, last, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		scanBySku(items, *last.Sku)
+	}
+}
+
+func BenchmarkScanAssetBank(b *testing.B) {
+	items, _, _, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		scanAssetBank(items)
+	}
+}
+
+func BenchmarkScanAssetGroup(b *testing.B) {
+	items, _, _, group := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		scanAssetGroup(items, group)
+	}
+}
+
+func BenchmarkScanCredits(b *testing.B) {
+	items, _, _, _ := benchCatalog(b)
+	for i := 0; i < b.N; i++ {
+		scanCredits(items)
+	}
+}
+
+func scanById(items []api.ShopItemData, id string) (api.ShopItemData, bool) {
+	for _, v := range items {
+		if *v.ItemId == id {
+			return v, true
+		}
+	}
+	return api.ShopItemData{}, false
+}
+
+func scanBySku(items []api.ShopItemData, sku string) (api.ShopItemData, bool) {
+	for _, v := range items {
+		if *v.Sku == sku {
+			return v, true
+		}
+	}
+	return api.ShopItemData{}, false
+}
+
+// scanGroup is the asset group of the old client, which held the raw entries
+type scanGroup struct {
+	Sku  string
+	Bank []api.ShopItemData
+}
+
+func scanAssetBank(items []api.ShopItemData) []scanGroup {
+	agd := []scanGroup{}
+	for _, v := range items {
+		if *v.CategoryPath != "/PreplanningAssets" {
+			continue
+		}
+		sku := strings.Split(*v.Sku, "_")[2]
+		f := false
+		for i, s := range agd {
+			if s.Sku == sku {
+				agd[i].Bank = append(agd[i].Bank, v)
+				f = true
+				break
+			}
+		}
+		if !f {
+			agd = append(agd, scanGroup{Sku: sku, Bank: []api.ShopItemData{v}})
+		}
+	}
+	return agd
+}
+
+func scanAssetGroup(items []api.ShopItemData, sku string) scanGroup {
+	for _, v := range scanAssetBank(items) {
+		if v.Sku == sku {
+			return v
+		}
+	}
+	return scanGroup{Bank: []api.ShopItemData{}}
+}
+
+func scanCredits(items []api.ShopItemData) []api.ShopItemData {
+	sid := []api.ShopItemData{}
+	for _, v := range items {
+		if v.TargetCurrencyCode != nil && *v.TargetCurrencyCode == "CRED" && *v.Purchasable && *v.Listable {
+			sid = append(sid, v)
+		}
+	}
+	return sid
+}
@@ -0,0 +1,122 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// Kinds of owned items, as the inventory groups them
+const (
+	InventoryPreplanning string = "Preplanning"
+	InventoryCoins       string = "C-Stacks"
+	InventoryOther       string = "Other"
+)
+
+// InventoryItem is what the user owns of one item, over all its entitlements
+type InventoryItem struct {
+	ItemId string
+	Sku    string
+	Name   string
+	Kind   string
+	// heist of a preplanning asset, empty for other kinds
+	Group string
+	// uses left, e.g. how many times an asset can still be brought to a heist
+	UseCount     int
+	Quantity     int
+	Entitlements int
+	// when the latest entitlement was granted
+	GrantedAt time.Time
+	// false for items the shop does not sell any more
+	InCatalog bool
+
+	// set by the UI
+	PrettyName      string
+	PrettyHeistName string
+}
+
+// JoinInventory groups the active entitlements by item and fills in what the
+// catalog knows about each, matching by item id first and SKU second
+func JoinInventory(ents []EntitlementData, cat *Catalog) []InventoryItem {
+	inv := []InventoryItem{}
+	at := map[string]int{}
+	for _, e := range ents {
+		if strOr(e.Status, "ACTIVE") != "ACTIVE" {
+			continue
+		}
+		id, sku := strOr(e.ItemId, ""), strOr(e.Sku, "")
+		it, ok := cat.ById(id)
+		if !ok && sku != "" {
+			it, ok = cat.BySku(sku)
+		}
+		if ok {
+			id, sku = it.Id, it.Sku
+		}
+		key := id
+		if key == "" {
+			key = sku
+		}
+		if key == "" {
+			continue
+		}
+
+		i, seen := at[key]
+		if !seen {
+			i = len(inv)
+			at[key] = i
+			inv = append(inv, newInventoryItem(id, sku, strOr(e.Name, ""), it, ok))
+		}
+		inv[i].Entitlements++
+		inv[i].Quantity += entitlementQuantity(e)
+		inv[i].UseCount += entitlementUses(e, it, ok)
+		if e.GrantedAt != nil && e.GrantedAt.After(inv[i].GrantedAt) {
+			inv[i].GrantedAt = *e.GrantedAt
+		}
+	}
+	return inv
+}
+
+func newInventoryItem(id string, sku string, name string, it Item, inCatalog bool) InventoryItem {
+	ii := InventoryItem{ItemId: id, Sku: sku, Name: name, Kind: InventoryOther, InCatalog: inCatalog}
+	if inCatalog {
+		ii.Name = it.Name
+	}
+	if ii.Name == "" {
+		ii.Name = sku
+	}
+	if s, err := ParseSKU(sku); err == nil {
+		switch s.Category {
+		case SkuPreplanning:
+			ii.Kind, ii.Group = InventoryPreplanning, s.Group
+		case SkuCoin:
+			ii.Kind = InventoryCoins
+		}
+	}
+	return ii
+}
+
+// entitlementUses is the number of uses left on an entitlement. Without a
+// count from Nebula every purchase is taken as unused.
+func entitlementUses(e EntitlementData, it Item, inCatalog bool) int {
+	for _, n := range []*int{e.StackedUseCount, e.UseCount} {
+		if n != nil && *n > 0 {
+			return *n
+		}
+	}
+	if inCatalog {
+		return it.UseCount * entitlementQuantity(e)
+	}
+	return entitlementQuantity(e)
+}
+
+// Inventory reloads the entitlements and joins them to the catalog
+func (c *Client) Inventory(ctx context.Context) ([]InventoryItem, error) {
+	if err := c.UpdateEntitlements(ctx); err != nil {
+		return nil, err
+	}
+	return JoinInventory(c.Entitlements(), c.Catalog()), nil
+}
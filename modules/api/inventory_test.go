@@ -0,0 +1,60 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func entitlement(itemId string, sku string, status string, quantity int) api.EntitlementData {
+	return api.EntitlementData{ItemId: &itemId, Sku: &sku, Status: &status, Quantity: &quantity}
+}
+
+func TestJoinInventory(t *testing.T) {
+	cat := api.NewCatalog(nebulamock.DefaultCatalog())
+	bag := nebulamock.MockItemId(ammo_bag)
+	coins := nebulamock.MockItemId("pd3_coin_goldmedium0")
+
+	inv := api.JoinInventory([]api.EntitlementData{
+		entitlement(bag, ammo_bag, "ACTIVE", 1),
+		entitlement(bag, ammo_bag, "ACTIVE", 2),
+		entitlement(bag, ammo_bag, "REVOKED", 5),
+		// matched by SKU when the id is unknown
+		entitlement("old-id", "pd3_coin_goldmedium0", "ACTIVE", 1),
+		entitlement("gone", "pd3_mask_retired", "ACTIVE", 1),
+	}, cat)
+
+	if len(inv) != 3 {
+		t.Fatalf("%d inventory items, want 3: %+v", len(inv), inv)
+	}
+	if got := inv[0]; got.ItemId != bag || got.Quantity != 3 || got.Entitlements != 2 || got.Kind != api.InventoryPreplanning || got.Group != "uni" {
+		t.Errorf("ammo bag %+v", got)
+	}
+	if got := inv[1]; got.ItemId != coins || got.Kind != api.InventoryCoins || got.UseCount != 5 {
+		t.Errorf("C-Stacks %+v, want 5 uses from the catalog", got)
+	}
+	if got := inv[2]; got.InCatalog || got.Kind != api.InventoryOther || got.Name != "pd3_mask_retired" {
+		t.Errorf("retired item %+v", got)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	_, c := loggedIn(t, func(m *nebulamock.Server) {
+		m.Grant(nebulamock.DefaultUserId, nebulamock.MockItemId(ammo_bag), 2)
+	})
+
+	inv, err := c.Inventory(context.Background())
+	if err != nil {
+		t.Fatalf("inventory failed: %v", err)
+	}
+	if len(inv) != 1 || inv[0].Sku != ammo_bag || inv[0].Quantity != 2 || !inv[0].InCatalog {
+		t.Errorf("inventory %+v, want 2 ammo bags", inv)
+	}
+}
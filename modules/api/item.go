@@ -0,0 +1,204 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const orderReturnUrl string = "http://127.0.0.1"
+
+// Item is a catalog entry that passed ToItem, so every field the shop relies on is set
+type Item struct {
+	Id                 string
+	Sku                string
+	Name               string
+	Namespace          string
+	CategoryPath       string
+	Status             string
+	ItemType           string
+	EntitlementType    string
+	TargetCurrencyCode string
+	Region             string
+	Language           string
+	Purchasable        bool
+	Listable           bool
+	Stackable          bool
+	// units granted per purchase, e.g. C-Stacks in a bundle; at least 1
+	UseCount int
+	// -1 when there is no limit
+	MaxCount        int
+	MaxCountPerUser int
+	Tags            []string
+	// at least one
+	Prices []Price
+
+	// set by the UI
+	PrettyName      string
+	PrettyHeistName string
+}
+
+// Price is the price of an item in one currency
+type Price struct {
+	CurrencyCode       string
+	CurrencyType       string
+	CurrencyNamespace  string
+	Price              int
+	DiscountedPrice    int
+	DiscountPercentage int
+	DiscountAmount     int
+	// bounds of the sale and of the discount, zero when not limited
+	PurchaseAt         time.Time
+	ExpireAt           time.Time
+	DiscountPurchaseAt time.Time
+	DiscountExpireAt   time.Time
+}
+
+// ItemError tells why a catalog entry was rejected
+type ItemError struct {
+	ItemId  string
+	Sku     string
+	Reasons []string
+}
+
+func (e *ItemError) Error() string {
+	name := e.Sku
+	if name == "" {
+		name = e.ItemId
+	}
+	if name == "" {
+		name = "item without id or SKU"
+	}
+	return fmt.Sprintf("%s: %s", name, strings.Join(e.Reasons, "; "))
+}
+
+// ToItem checks d and turns it into an Item. Missing flags read as false; missing
+// ids, names, region, language or prices reject the item.
+func ToItem(d ShopItemData) (Item, error) {
+	reasons := []string{}
+	required := func(field string, v *string) string {
+		if v == nil || *v == "" {
+			reasons = append(reasons, field+" is missing")
+			return ""
+		}
+		return *v
+	}
+
+	it := Item{
+		Id:                 required("itemId", d.ItemId),
+		Sku:                required("sku", d.Sku),
+		CategoryPath:       required("categoryPath", d.CategoryPath),
+		Region:             required("region", d.Region),
+		Language:           required("language", d.Language),
+		Namespace:          strOr(d.Namespace, ""),
+		Status:             strOr(d.Status, ""),
+		ItemType:           strOr(d.ItemType, ""),
+		EntitlementType:    strOr(d.EntitlementType, ""),
+		TargetCurrencyCode: strOr(d.TargetCurrencyCode, ""),
+		Purchasable:        d.Purchasable != nil && *d.Purchasable,
+		Listable:           d.Listable != nil && *d.Listable,
+		Stackable:          d.Stackable != nil && *d.Stackable,
+		UseCount:           intOr(d.UseCount, 1),
+		MaxCount:           intOr(d.MaxCount, -1),
+		MaxCountPerUser:    intOr(d.MaxCountPerUser, -1),
+		Tags:               []string{},
+		Prices:             []Price{},
+	}
+	it.Name = strOr(d.Name, strOr(d.Title, ""))
+	if it.Name == "" {
+		reasons = append(reasons, "name is missing")
+	}
+	if it.UseCount < 1 {
+		reasons = append(reasons, fmt.Sprintf("useCount %d is not positive", it.UseCount))
+	}
+	if d.Tags != nil {
+		it.Tags = append(it.Tags, *d.Tags...)
+	}
+	if it.CategoryPath == preplanningCategory && it.Sku != "" {
+		sku, err := ParseSKU(it.Sku)
+		if err == nil && sku.Category != SkuPreplanning {
+			err = &SKUError{Sku: it.Sku, Reason: "not a preplanning SKU"}
+		}
+		if err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+
+	if d.RegionData == nil || len(*d.RegionData) == 0 {
+		reasons = append(reasons, "no prices")
+	} else {
+		for i, rd := range *d.RegionData {
+			p, err := toPrice(rd)
+			if err != nil {
+				reasons = append(reasons, fmt.Sprintf("price %d: %s", i+1, err.Error()))
+				continue
+			}
+			it.Prices = append(it.Prices, p)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return Item{}, &ItemError{ItemId: strOr(d.ItemId, ""), Sku: strOr(d.Sku, ""), Reasons: reasons}
+	}
+	return it, nil
+}
+
+func toPrice(rd ItemRegionData) (Price, error) {
+	if rd.CurrencyCode == nil || *rd.CurrencyCode == "" {
+		return Price{}, fmt.Errorf("currencyCode is missing")
+	}
+	if rd.Price == nil {
+		return Price{}, fmt.Errorf("price is missing")
+	}
+	p := Price{
+		CurrencyCode:       *rd.CurrencyCode,
+		CurrencyType:       strOr(rd.CurrencyType, ""),
+		CurrencyNamespace:  strOr(rd.CurrencyNamespace, ""),
+		Price:              *rd.Price,
+		DiscountedPrice:    intOr(rd.DiscountedPrice, *rd.Price),
+		DiscountPercentage: intOr(rd.DiscountPercentage, 0),
+		DiscountAmount:     intOr(rd.DiscountAmount, 0),
+	}
+	for _, t := range []struct {
+		dst *time.Time
+		src *time.Time
+	}{
+		{&p.PurchaseAt, rd.PurchaseAt},
+		{&p.ExpireAt, rd.ExpireAt},
+		{&p.DiscountPurchaseAt, rd.DiscountPurchaseAt},
+		{&p.DiscountExpireAt, rd.DiscountExpireAt},
+	} {
+		if t.src != nil {
+			*t.dst = *t.src
+		}
+	}
+	if p.Price < 0 || p.DiscountedPrice < 0 {
+		return Price{}, fmt.Errorf("negative price")
+	}
+	return p, nil
+}
+
+// ValidateItems converts every entry, keeping the rejected ones apart with their reasons
+func ValidateItems(items []ShopItemData) ([]Item, []*ItemError) {
+	valid := make([]Item, 0, len(items))
+	rejected := []*ItemError{}
+	for _, d := range items {
+		it, err := ToItem(d)
+		if err != nil {
+			rejected = append(rejected, err.(*ItemError))
+			continue
+		}
+		valid = append(valid, it)
+	}
+	return valid, rejected
+}
+
+// ForSale tells whether the shop lets the item be bought
+func (it Item) ForSale() bool {
+	return it.Purchasable && it.Listable
+}
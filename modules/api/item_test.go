@@ -0,0 +1,77 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"errors"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestToItem(t *testing.T) {
+	d := nebulamock.NewItem(ammo_bag, "Ammo Bag", "/PreplanningAssets", "CASH", 25000, 20000)
+
+	it, err := api.ToItem(d)
+	if err != nil {
+		t.Fatalf("valid entry rejected: %v", err)
+	}
+	if it.Id != *d.ItemId || it.Sku != ammo_bag || it.Name != "Ammo Bag" || !it.ForSale() {
+		t.Errorf("item %+v", it)
+	}
+	if it.MaxCount != -1 || it.MaxCountPerUser != -1 || it.UseCount != 1 {
+		t.Errorf("limits %d/%d and use count %d, want unlimited and 1", it.MaxCount, it.MaxCountPerUser, it.UseCount)
+	}
+
+	line := it.Order(it.Prices[0], 3)
+	if line.ItemId != it.Id || line.Price != 3*25000 || line.DiscountedPrice != 3*20000 || line.CurrencyCode != "CASH" {
+		t.Errorf("cart line %+v", line)
+	}
+}
+
+func TestToItemRejects(t *testing.T) {
+	tests := map[string]func(d *api.ShopItemData){
+		"no id":     func(d *api.ShopItemData) { d.ItemId = nil },
+		"no sku":    func(d *api.ShopItemData) { d.Sku = nil },
+		"no region": func(d *api.ShopItemData) { d.Region = nil },
+		"no prices": func(d *api.ShopItemData) { d.RegionData = &[]api.ItemRegionData{} },
+		"no name": func(d *api.ShopItemData) {
+			d.Name = nil
+			d.Title = nil
+		},
+		"negative price": func(d *api.ShopItemData) {
+			p := -1
+			(*d.RegionData)[0].Price = &p
+		},
+	}
+	for name, spoil := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := nebulamock.NewItem(ammo_bag, "Ammo Bag", "/PreplanningAssets", "CASH", 25000, 20000)
+			spoil(&d)
+			_, err := api.ToItem(d)
+			var ie *api.ItemError
+			if !errors.As(err, &ie) || len(ie.Reasons) == 0 {
+				t.Errorf("got %v, want an ItemError with reasons", err)
+			}
+		})
+	}
+}
+
+func TestValidateItemsKeepsRejected(t *testing.T) {
+	items := nebulamock.DefaultCatalog()
+	bad := nebulamock.NewItem("pd3_filler_1", "Filler", "/Cosmetics", "CASH", 1000, 1000)
+	bad.Language = nil
+	items = append(items, bad)
+
+	valid, rejected := api.ValidateItems(items)
+	if len(valid) != len(items)-1 {
+		t.Errorf("%d valid items, want %d", len(valid), len(items)-1)
+	}
+	if len(rejected) != 1 || rejected[0].Sku != "pd3_filler_1" {
+		t.Errorf("rejected %v, want pd3_filler_1", rejected)
+	}
+}
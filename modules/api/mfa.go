@@ -0,0 +1,61 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+// Second factors IAM may ask for
+const (
+	FactorAuthenticator string = "authenticator"
+	FactorBackupCode    string = "backupCode"
+	FactorEmail         string = "email"
+)
+
+// SendMFACode asks IAM to email a one-time code for the pending login
+func (c *Client) SendMFACode(ctx context.Context, ch *MFARequiredError) error {
+	_, err := c.request(ctx, "/iam/v3/oauth/mfa/code", "POST", []header{
+		{Key: "Authorization", Value: basic_auth},
+		{Key: "Content-Type", Value: "application/x-www-form-urlencoded;charset=UTF-8"},
+	}, url.Values{"mfaToken": {ch.Token}}.Encode(), 204)
+	return err
+}
+
+// VerifyMFA finishes a login Init stopped at the second factor and loads the
+// account like Init does. rememberDevice asks IAM for an AuthTrustId, which
+// lets refreshes and later logins on this device skip the second factor.
+func (c *Client) VerifyMFA(ctx context.Context, ch *MFARequiredError, factor string, code string, rememberDevice bool) error {
+	if code == "" {
+		return errors.New("the code cannot be empty")
+	}
+	if factor == "" {
+		factor = ch.DefaultFactor
+	}
+	ld, err := c.issueTokens(ctx, "/iam/v3/oauth/mfa/verify", url.Values{
+		"mfaToken":       {ch.Token},
+		"factor":         {factor},
+		"code":           {code},
+		"rememberDevice": {boolString(rememberDevice)},
+	}, "")
+	var ae *AuthError
+	if errors.As(err, &ae) {
+		ae.Message = "the code is incorrect or expired"
+	}
+	if err != nil {
+		return err
+	}
+	return c.begin(ctx, ld, ch.login, ch.password, ch.remember)
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,67 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+const mfa_login string = "twofactor@example.com"
+
+// mfaChallenge starts a login of an account with a second factor and returns its challenge
+func mfaChallenge(t *testing.T) (*api.Client, *api.MFARequiredError) {
+	t.Helper()
+	mock, url := startMock(t)
+	mock.AddAccount(nebulamock.Account{UserId: "mfauser", Login: mfa_login, Password: "secret", MFACode: "123456",
+		Balances: map[string]int{"CASH": 1000, "GOLD": 0, "CRED": 0}})
+	c := newClient(t, url)
+
+	err := c.Init(context.Background(), mfa_login, "secret", api.RememberNothing)
+	var ch *api.MFARequiredError
+	if !errors.As(err, &ch) {
+		t.Fatalf("got %v, want an MFARequiredError", err)
+	}
+	if c.LoggedIn() {
+		t.Fatal("logged in before the second factor")
+	}
+	return c, ch
+}
+
+func TestMFALogin(t *testing.T) {
+	c, ch := mfaChallenge(t)
+	ctx := context.Background()
+
+	if err := c.SendMFACode(ctx, ch); err != nil {
+		t.Errorf("sending the code failed: %v", err)
+	}
+	if err := c.VerifyMFA(ctx, ch, "", "123456", true); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if got := c.Session().UserId; got != "mfauser" {
+		t.Errorf("user id %q, want mfauser", got)
+	}
+	if c.Session().AuthTrustId == "" {
+		t.Error("no AuthTrustId for a remembered device")
+	}
+}
+
+func TestMFAWrongCode(t *testing.T) {
+	c, ch := mfaChallenge(t)
+
+	err := c.VerifyMFA(context.Background(), ch, "", "000000", false)
+	var ae *api.AuthError
+	if !errors.As(err, &ae) {
+		t.Fatalf("got %v, want an AuthError", err)
+	}
+	if c.LoggedIn() {
+		t.Error("logged in with a wrong code")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+// shared fixtures of the tests that run against the Nebula stand-in
+
+const ammo_bag string = "pd3_preplanning_uni_ammobag"
+
+// startMock serves a fresh stand-in for the length of the test
+func startMock(t *testing.T) (*nebulamock.Server, string) {
+	t.Helper()
+	mock := nebulamock.New()
+	srv := mock.Start()
+	t.Cleanup(srv.Close)
+	return mock, srv.URL
+}
+
+// fastOptions keep the rate limit and retries quick enough for tests
+func fastOptions() []api.Option {
+	return []api.Option{
+		api.WithRateLimit(api.RateLimit{Rate: 1000, Burst: 1000, MinRate: 100}),
+		api.WithRetryPolicy(api.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxRetryAfter: time.Second}),
+	}
+}
+
+func newClient(t *testing.T, url string) *api.Client {
+	t.Helper()
+	c := api.NewClient(append(fastOptions(), api.WithBaseURL(url))...)
+	t.Cleanup(c.Disconnect)
+	return c
+}
+
+// loggedIn is a client logged in to a fresh stand-in as the default account.
+// prepare, if set, scripts the stand-in before the login.
+func loggedIn(t *testing.T, prepare func(*nebulamock.Server)) (*nebulamock.Server, *api.Client) {
+	t.Helper()
+	mock, url := startMock(t)
+	if prepare != nil {
+		prepare(mock)
+	}
+	c := newClient(t, url)
+	if err := c.Init(context.Background(), nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberNothing); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	return mock, c
+}
+
+func mustItem(t *testing.T, c *api.Client, sku string) api.Item {
+	t.Helper()
+	it, err := c.GetItemBySKU(sku)
+	if err != nil {
+		t.Fatalf("%s: %v", sku, err)
+	}
+	return it
+}
+
+// orderLine is a cart line for quantity of sku, priced in currency
+func orderLine(t *testing.T, c *api.Client, sku string, currency string, quantity int) api.OrderInitData {
+	t.Helper()
+	it := mustItem(t, c, sku)
+	p, err := c.ResolvePrice(it, currency)
+	if err != nil {
+		t.Fatalf("%s: %v", sku, err)
+	}
+	return it.Order(p, quantity)
+}
+
+func balance(t *testing.T, c *api.Client, code string) int {
+	t.Helper()
+	w, err := c.GetCachedWalletByCode(code)
+	if err != nil || w.Balance == nil {
+		t.Fatalf("no %s wallet: %v", code, err)
+	}
+	return *w.Balance
+}
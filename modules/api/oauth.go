@@ -0,0 +1,147 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// BrowserLoginTimeout bounds how long LoginWithBrowser waits for the user to finish in the browser
+const BrowserLoginTimeout time.Duration = 5 * time.Minute
+
+const callbackPath string = "/callback"
+
+const callbackPage string = `<!DOCTYPE html>
+<html><head><title>PayShop3</title></head>
+<body style="font-family: sans-serif; text-align: center; margin-top: 4em">
+<h2>%s</h2><p>You can close this window and return to PayShop3.</p>
+</body></html>`
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// LoginWithBrowser logs in with the authorization code flow and PKCE. The IAM
+// authorize page is handed to open, which usually starts the system browser;
+// the code is caught by a listener on the loopback interface and exchanged for
+// the same session a password login gets. There is no password to remember, so
+// RememberPassword is treated as RememberSession.
+func (c *Client) LoginWithBrowser(ctx context.Context, open func(url string) error, remember Remember) error {
+	if remember != RememberNothing && c.sessionStore() == nil {
+		return errors.New("a passphrase is required to save login info")
+	}
+	if remember == RememberPassword {
+		remember = RememberSession
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("could not start the login listener: %w", err)
+	}
+	redirect := fmt.Sprintf("http://%s%s", ln.Addr().String(), callbackPath)
+
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var res callbackResult
+		switch {
+		case q.Get("state") != state:
+			// not ours, keep waiting for the real redirect
+			http.Error(w, "unexpected login state", http.StatusBadRequest)
+			return
+		case q.Get("error") != "":
+			msg := q.Get("error")
+			if d := q.Get("error_description"); d != "" {
+				msg = d
+			}
+			res.err = &AuthError{APIError{Message: msg}}
+		case q.Get("code") == "":
+			res.err = &AuthError{APIError{Message: "no authorization code in the redirect"}}
+		default:
+			res.code = q.Get("code")
+		}
+		title := "Logged in"
+		if res.err != nil {
+			title = "Login failed: " + res.err.Error()
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, callbackPage, title)
+		select {
+		case results <- res:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	authorize := fmt.Sprintf("%s/iam/v3/oauth/authorize?%s", c.baseURL, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.clientID},
+		"redirect_uri":          {redirect},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+	}.Encode())
+	if err := open(authorize); err != nil {
+		return fmt.Errorf("could not open the browser: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, BrowserLoginTimeout)
+	defer cancel()
+	var res callbackResult
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if res.err != nil {
+		return res.err
+	}
+
+	c.tokens.stop()
+	ld, err := c.tokenGrant(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {c.clientID},
+		"code":          {res.code},
+		"redirect_uri":  {redirect},
+		"code_verifier": {verifier},
+	}, "")
+	if err != nil {
+		return err
+	}
+	return c.begin(ctx, ld, "", "", remember)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,55 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+// browser follows the authorize URL and its redirect back to the client, as a browser would
+func browser(u string) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestLoginWithBrowser(t *testing.T) {
+	_, url := startMock(t)
+	c := newClient(t, url)
+
+	if err := c.LoginWithBrowser(context.Background(), browser, api.RememberNothing); err != nil {
+		t.Fatalf("browser login failed: %v", err)
+	}
+	if got := c.Session().UserId; got != nebulamock.DefaultUserId {
+		t.Errorf("user id %q, want %q", got, nebulamock.DefaultUserId)
+	}
+	if got := balance(t, c, "CASH"); got != 50000000 {
+		t.Errorf("CASH balance %d, want 50000000", got)
+	}
+}
+
+func TestLoginWithBrowserDenied(t *testing.T) {
+	mock, url := startMock(t)
+	mock.BrowserLogin = "nobody@example.com"
+	c := newClient(t, url)
+
+	err := c.LoginWithBrowser(context.Background(), browser, api.RememberNothing)
+	var ae *api.AuthError
+	if !errors.As(err, &ae) {
+		t.Fatalf("got %v, want an AuthError", err)
+	}
+	if c.LoggedIn() {
+		t.Error("logged in without the consent of the user")
+	}
+}
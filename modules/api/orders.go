@@ -0,0 +1,156 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const OrderPageSize int = 50
+
+// OrderPollInterval is how often WaitForOrder asks for the status of an order
+const OrderPollInterval time.Duration = 5 * time.Second
+
+// OrderFollowLimit is how long WaitForOrder follows an order at most
+const OrderFollowLimit time.Duration = 10 * time.Minute
+
+// OrderStatuses are the states a Nebula order can be in
+var OrderStatuses []string = []string{
+	"INIT",
+	"CHARGED",
+	"CHARGEBACK",
+	"CHARGEBACK_REVERSED",
+	"FULFILLED",
+	"FULFILL_FAILED",
+	"REFUNDING",
+	"REFUNDED",
+	"REFUND_FAILED",
+	"CLOSED",
+	"DELETED",
+}
+
+// OrderSettled tells whether an order is done changing status. Orders waiting
+// on a payment, being charged or refunded are not.
+func OrderSettled(status string) bool {
+	switch status {
+	case "INIT", "CHARGED", "REFUNDING":
+		return false
+	}
+	return true
+}
+
+// OrderFilter narrows the order history. Nebula matches the status, the dates
+// are checked against the creation time of the orders. Zero values match all.
+type OrderFilter struct {
+	Status string
+	From   time.Time
+	Until  time.Time
+}
+
+func (f OrderFilter) match(o OrderRespData) bool {
+	if o.CreatedTime == nil {
+		return f.From.IsZero() && f.Until.IsZero()
+	}
+	return inWindow(*o.CreatedTime, f.From, f.Until)
+}
+
+type orderPage struct {
+	Data   []OrderRespData `json:"data"`
+	Paging pagingData      `json:"paging"`
+}
+
+// OrderHistory pages through the orders of the user, newest first. Paging
+// stops at the first order older than f.From.
+func (c *Client) OrderHistory(ctx context.Context, f OrderFilter) ([]OrderRespData, error) {
+	orders := []OrderRespData{}
+	path := c.nsPath("/users/%s/orders?offset=0&limit=%d", c.Session().UserId, OrderPageSize)
+	if f.Status != "" {
+		path += "&status=" + url.QueryEscape(f.Status)
+	}
+	seen := map[string]bool{}
+	for path != "" && !seen[path] {
+		seen[path] = true
+		raw, err := c.request(ctx, path, "GET", []header{}, "", 200)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query orders: %w", err)
+		}
+		var page orderPage
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, errors.New("failed to parse orders response")
+		}
+		for _, o := range page.Data {
+			if !f.From.IsZero() && o.CreatedTime != nil && o.CreatedTime.Before(f.From) {
+				return orders, nil
+			}
+			if f.match(o) {
+				orders = append(orders, o)
+			}
+		}
+		if len(page.Data) == 0 || page.Paging.Next == nil {
+			break
+		}
+		path, err = nextPagePath(*page.Paging.Next)
+		if err != nil {
+			return nil, errors.New("failed to parse orders response")
+		}
+	}
+	return orders, nil
+}
+
+// GetOrder fetches a single order of the user
+func (c *Client) GetOrder(ctx context.Context, orderNo string) (OrderRespData, error) {
+	raw, err := c.request(ctx, c.nsPath("/users/%s/orders/%s", c.Session().UserId, url.PathEscape(orderNo)), "GET", []header{}, "", 200)
+	if err != nil {
+		return OrderRespData{}, fmt.Errorf("failed to query order %s: %w", orderNo, err)
+	}
+	var od OrderRespData
+	if err := json.Unmarshal(raw, &od); err != nil {
+		return OrderRespData{}, fmt.Errorf("failed to read order %s: %w", orderNo, err)
+	}
+	return od, nil
+}
+
+// WaitForOrder polls the order every OrderPollInterval until it settles, ctx
+// ends or OrderFollowLimit passes, calling onChange whenever its status changes.
+// It returns the last state seen; the error tells why it stopped following an
+// order that did not settle, the one of ctx or an AuthError of a lost session.
+func (c *Client) WaitForOrder(ctx context.Context, od OrderRespData, onChange func(OrderRespData)) (OrderRespData, error) {
+	if od.OrderNo == nil {
+		return od, errors.New("order has no number to follow")
+	}
+	ctx, cancel := context.WithTimeout(ctx, OrderFollowLimit)
+	defer cancel()
+	t := time.NewTicker(OrderPollInterval)
+	defer t.Stop()
+	for od.Status == nil || !OrderSettled(*od.Status) {
+		select {
+		case <-ctx.Done():
+			return od, ctx.Err()
+		case <-t.C:
+		}
+		next, err := c.GetOrder(ctx, *od.OrderNo)
+		var ae *AuthError
+		if errors.As(err, &ae) {
+			// no later poll would get through either
+			return od, err
+		}
+		if err != nil {
+			// a failed poll is retried on the next tick
+			c.log.Printf("polling order %s: %v", *od.OrderNo, err)
+			continue
+		}
+		if onChange != nil && (od.Status == nil || next.Status == nil || *next.Status != *od.Status) {
+			onChange(next)
+		}
+		od = next
+	}
+	return od, nil
+}
@@ -0,0 +1,137 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+// paid in USD, so the order waits on the payment station
+const credits string = "pd3_credits_500"
+
+// placeOrder orders one unit of the item and fails the test if it cannot
+func placeOrder(t *testing.T, c *api.Client, sku string, currency string) api.OrderRespData {
+	t.Helper()
+	od, err := c.ExecOrder(context.Background(), orderLine(t, c, sku, currency, 1))
+	if err != nil {
+		t.Fatalf("order of %s failed: %v", sku, err)
+	}
+	return od
+}
+
+func TestOrderHistoryPaging(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	placed := api.OrderPageSize + 5
+	var last api.OrderRespData
+	for i := 0; i < placed; i++ {
+		last = placeOrder(t, c, ammo_bag, "CASH")
+	}
+	pending := placeOrder(t, c, credits, "USD")
+
+	orders, err := c.OrderHistory(context.Background(), api.OrderFilter{})
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(orders) != placed+1 {
+		t.Fatalf("%d orders, want %d", len(orders), placed+1)
+	}
+	if got := mock.Hits(nebulamock.RouteOrderHistory); got != 2 {
+		t.Errorf("%d history pages fetched, want 2", got)
+	}
+	// newest first
+	if *orders[0].OrderNo != *pending.OrderNo || *orders[1].OrderNo != *last.OrderNo {
+		t.Errorf("history starts with %s and %s, want %s and %s", *orders[0].OrderNo, *orders[1].OrderNo, *pending.OrderNo, *last.OrderNo)
+	}
+
+	init, err := c.OrderHistory(context.Background(), api.OrderFilter{Status: "INIT"})
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(init) != 1 || *init[0].OrderNo != *pending.OrderNo {
+		t.Errorf("%d INIT orders, want only %s", len(init), *pending.OrderNo)
+	}
+
+	future, err := c.OrderHistory(context.Background(), api.OrderFilter{From: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(future) != 0 {
+		t.Errorf("%d orders from the future", len(future))
+	}
+}
+
+func TestWaitForOrderSettles(t *testing.T) {
+	t.Parallel()
+	mock, c := loggedIn(t, nil)
+	od := placeOrder(t, c, credits, "USD")
+	if *od.Status != "INIT" {
+		t.Fatalf("order status %s, want INIT", *od.Status)
+	}
+	time.AfterFunc(api.OrderPollInterval/2, func() {
+		mock.SetOrderStatus(nebulamock.DefaultUserId, *od.OrderNo, "FULFILLED")
+	})
+
+	changes := []string{}
+	final, err := c.WaitForOrder(context.Background(), od, func(next api.OrderRespData) {
+		changes = append(changes, *next.Status)
+	})
+	if err != nil {
+		t.Fatalf("following failed: %v", err)
+	}
+	if *final.Status != "FULFILLED" {
+		t.Errorf("final status %s, want FULFILLED", *final.Status)
+	}
+	if len(changes) != 1 || changes[0] != "FULFILLED" {
+		t.Errorf("status changes %v, want FULFILLED once", changes)
+	}
+	if got := len(mock.Entitlements(nebulamock.DefaultUserId)); got != 1 {
+		t.Errorf("%d entitlements granted, want 1", got)
+	}
+}
+
+func TestWaitForOrderStopsOnLostSession(t *testing.T) {
+	t.Parallel()
+	_, c := loggedIn(t, nil)
+	od := placeOrder(t, c, credits, "USD")
+	ld := c.Session()
+	for _, tok := range []string{ld.RefreshToken, ld.Token} {
+		if err := c.RevokeToken(context.Background(), tok); err != nil {
+			t.Fatalf("revoke failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*api.OrderPollInterval)
+	defer cancel()
+	final, err := c.WaitForOrder(ctx, od, nil)
+	var ae *api.AuthError
+	if !errors.As(err, &ae) {
+		t.Fatalf("got %v, want an AuthError", err)
+	}
+	if *final.Status != "INIT" {
+		t.Errorf("last status %s, want INIT", *final.Status)
+	}
+}
+
+func TestWaitForOrderStopsWithContext(t *testing.T) {
+	_, c := loggedIn(t, nil)
+	od := placeOrder(t, c, credits, "USD")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	final, err := c.WaitForOrder(ctx, od, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the deadline of ctx", err)
+	}
+	if *final.OrderNo != *od.OrderNo || *final.Status != "INIT" {
+		t.Errorf("got %s %s, want the order as placed", *final.OrderNo, *final.Status)
+	}
+}
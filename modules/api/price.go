@@ -0,0 +1,144 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// Currencies lists the currencies the item is sold for, in catalog order
+func (it Item) Currencies() []string {
+	arr := []string{}
+	for _, p := range it.Prices {
+		arr = append(arr, p.CurrencyCode)
+	}
+	return arr
+}
+
+func inWindow(at time.Time, from time.Time, until time.Time) bool {
+	return (from.IsZero() || !at.Before(from)) && (until.IsZero() || at.Before(until))
+}
+
+// OnSale tells whether the price can be ordered at the given time
+func (p Price) OnSale(at time.Time) bool {
+	return inWindow(at, p.PurchaseAt, p.ExpireAt)
+}
+
+// DiscountActive tells whether DiscountedPrice is charged at the given time
+func (p Price) DiscountActive(at time.Time) bool {
+	return p.DiscountedPrice != p.Price && inWindow(at, p.DiscountPurchaseAt, p.DiscountExpireAt)
+}
+
+// At is the price as charged at the given time: outside its window the discount does not apply
+func (p Price) At(at time.Time) Price {
+	if !p.DiscountActive(at) {
+		p.DiscountedPrice = p.Price
+		p.DiscountPercentage = 0
+		p.DiscountAmount = 0
+	}
+	return p
+}
+
+// PriceFor picks the price to order it with at the given time. A currency the
+// user chose must be offered and on sale; with none chosen the first price on
+// sale in a currency the user has a wallet for wins, then the first price on sale.
+func (it Item) PriceFor(currency string, wallets []string, at time.Time) (Price, error) {
+	if currency != "" {
+		for _, p := range it.Prices {
+			if p.CurrencyCode != currency {
+				continue
+			}
+			if !p.OnSale(at) {
+				return Price{}, &ItemUnavailableError{APIError{Message: fmt.Sprintf("%s is not on sale for %s right now", it.Name, currency)}}
+			}
+			return p.At(at), nil
+		}
+		return Price{}, &ItemUnavailableError{APIError{Message: fmt.Sprintf("%s is not sold for %s", it.Name, currency)}}
+	}
+	onSale := []Price{}
+	for _, p := range it.Prices {
+		if p.OnSale(at) {
+			onSale = append(onSale, p)
+		}
+	}
+	if len(onSale) == 0 {
+		return Price{}, &ItemUnavailableError{APIError{Message: fmt.Sprintf("%s is not on sale right now", it.Name)}}
+	}
+	for _, p := range onSale {
+		for _, w := range wallets {
+			if p.CurrencyCode == w {
+				return p.At(at), nil
+			}
+		}
+	}
+	return onSale[0].At(at), nil
+}
+
+// Order makes a cart line for quantity units of the item at price p, as returned by PriceFor
+func (it Item) Order(p Price, quantity int) OrderInitData {
+	line := OrderInitData{
+		ItemId:          it.Id,
+		Quantity:        quantity,
+		Price:           p.Price * quantity,
+		DiscountedPrice: p.DiscountedPrice * quantity,
+		CurrencyCode:    p.CurrencyCode,
+		Region:          it.Region,
+		Language:        it.Language,
+		ReturnUrl:       orderReturnUrl,
+		PrettyName:      it.PrettyName,
+		PrettyHeistName: it.PrettyHeistName,
+	}
+	if p.DiscountedPrice != p.Price {
+		line.DiscountExpireAt = p.DiscountExpireAt
+	}
+	return line
+}
+
+// WalletCurrencies returns the codes of the wallets loaded for the user
+func (c *Client) WalletCurrencies() []string {
+	arr := []string{}
+	for _, w := range c.Wallets() {
+		if w.CurrencyCode != nil {
+			arr = append(arr, *w.CurrencyCode)
+		}
+	}
+	return arr
+}
+
+// ResolvePrice is PriceFor with the wallets of the user at Nebula time; currency "" means automatic
+func (c *Client) ResolvePrice(it Item, currency string) (Price, error) {
+	return it.PriceFor(currency, c.WalletCurrencies(), c.ServerNow())
+}
+
+// Reprice brings a cart line to the current price of its item, in the same currency
+func (c *Client) Reprice(line OrderInitData) (OrderInitData, error) {
+	it, err := c.LookupItemByIdLocal(line.ItemId)
+	if err != nil {
+		return line, err
+	}
+	p, err := c.ResolvePrice(it, line.CurrencyCode)
+	if err != nil {
+		return line, err
+	}
+	it.PrettyName, it.PrettyHeistName = line.PrettyName, line.PrettyHeistName
+	nl := it.Order(p, line.Quantity)
+	nl.LimitNote = line.LimitNote
+	return nl, nil
+}
+
+// Country is the country claim of the session, used as the catalog region. It is
+// empty while logged out or when the token has none.
+func (c *Client) Country() string {
+	if c.Session().Token == "" {
+		return ""
+	}
+	cl, err := c.Claims()
+	if err != nil || cl.Country == nil {
+		return ""
+	}
+	return *cl.Country
+}
@@ -0,0 +1,125 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestPriceFor(t *testing.T) {
+	it := api.Item{Name: "Mask", Prices: []api.Price{
+		{CurrencyCode: "GOLD", Price: 10, DiscountedPrice: 10},
+		{CurrencyCode: "CASH", Price: 5000, DiscountedPrice: 4000},
+	}}
+
+	tests := []struct {
+		name     string
+		currency string
+		wallets  []string
+		want     string
+	}{
+		{"chosen", "CASH", []string{"GOLD"}, "CASH"},
+		{"first wallet match", "", []string{"CRED", "CASH"}, "CASH"},
+		{"first price without a wallet", "", []string{"CRED"}, "GOLD"},
+	}
+	for _, tt := range tests {
+		p, err := it.PriceFor(tt.currency, tt.wallets, time.Now())
+		if err != nil || p.CurrencyCode != tt.want {
+			t.Errorf("%s: got %s, %v, want %s", tt.name, p.CurrencyCode, err, tt.want)
+		}
+	}
+
+	_, err := it.PriceFor("CRED", nil, time.Now())
+	var ue *api.ItemUnavailableError
+	if !errors.As(err, &ue) {
+		t.Errorf("got %v for a currency the item is not sold for, want an ItemUnavailableError", err)
+	}
+}
+
+func TestCatalogRegionFallsBack(t *testing.T) {
+	mock, url := startMock(t)
+	mock.AddAccount(nebulamock.Account{UserId: "deuser", Login: "de@example.com", Password: "secret", Country: "DE",
+		Balances: map[string]int{"CASH": 1000, "GOLD": 0, "CRED": 0}})
+	c := newClient(t, url)
+
+	if err := c.Init(context.Background(), "de@example.com", "secret", api.RememberNothing); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if got := c.Country(); got != "DE" {
+		t.Errorf("country %q, want DE", got)
+	}
+	// the stand-in prices everything for US only
+	if got, want := c.Catalog().Len(), len(nebulamock.DefaultCatalog()); got != want {
+		t.Errorf("%d catalog items, want the %d of the default region", got, want)
+	}
+	if got := c.CatalogInfo().Region; got != "" {
+		t.Errorf("catalog region %q, want the default one", got)
+	}
+	if got := mock.Hits(nebulamock.RouteCatalog); got != 2 {
+		t.Errorf("%d catalog requests, want DE and the default region", got)
+	}
+}
+
+func TestPriceWindows(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := api.Price{CurrencyCode: "CASH", Price: 1000, DiscountedPrice: 800,
+		PurchaseAt: now.Add(-time.Hour), ExpireAt: now.Add(time.Hour),
+		DiscountPurchaseAt: now.Add(-time.Hour), DiscountExpireAt: now.Add(time.Minute)}
+
+	if !p.OnSale(now) || p.OnSale(now.Add(-2*time.Hour)) || p.OnSale(now.Add(time.Hour)) {
+		t.Error("sale window not honored")
+	}
+	if !p.DiscountActive(now) || p.DiscountActive(now.Add(time.Minute)) {
+		t.Error("discount window not honored")
+	}
+	if got := p.At(now).DiscountedPrice; got != 800 {
+		t.Errorf("%d charged during the discount, want 800", got)
+	}
+	if got := p.At(now.Add(2 * time.Minute)).DiscountedPrice; got != 1000 {
+		t.Errorf("%d charged after the discount, want 1000", got)
+	}
+
+	it := api.Item{Name: "Mask", Prices: []api.Price{p}}
+	_, err := it.PriceFor("", nil, now.Add(2*time.Hour))
+	var ue *api.ItemUnavailableError
+	if !errors.As(err, &ue) {
+		t.Errorf("got %v after the sale ended, want an ItemUnavailableError", err)
+	}
+}
+
+func TestRepriceAfterDiscountEnds(t *testing.T) {
+	ended := time.Now().Add(-time.Minute)
+	mock, c := loggedIn(t, func(m *nebulamock.Server) {
+		sale := nebulamock.NewItem("pd3_preplanning_uni_sale", "Sale Bag", "/PreplanningAssets", "CASH", 1000, 800)
+		(*sale.RegionData)[0].DiscountExpireAt = &ended
+		m.SetCatalog(append(nebulamock.DefaultCatalog(), sale))
+	})
+	it := mustItem(t, c, "pd3_preplanning_uni_sale")
+	stale := it.Order(it.Prices[0], 2)
+
+	line, err := c.Reprice(stale)
+	if err != nil {
+		t.Fatalf("reprice failed: %v", err)
+	}
+	if line.DiscountedPrice != line.Price {
+		t.Errorf("repriced to %d, want the full %d", line.DiscountedPrice, line.Price)
+	}
+	if _, err := c.ExecOrder(context.Background(), line); err != nil {
+		t.Errorf("the repriced line was refused: %v", err)
+	}
+	if _, err := c.ExecOrder(context.Background(), stale); err == nil {
+		t.Error("the stale discount went through")
+	}
+	if got := len(mock.Orders(nebulamock.DefaultUserId)); got != 1 {
+		t.Errorf("%d orders placed, want 1", got)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit configures the token bucket every request of a Client goes through.
+// Rate is the ceiling in requests per second; the limiter halves its current
+// rate on 429/5xx (never below MinRate) and climbs back after SpeedUpAfter
+// successful responses in a row.
+type RateLimit struct {
+	Rate         float64 `json:"rate"`
+	Burst        int     `json:"burst"`
+	MinRate      float64 `json:"min_rate"`
+	SpeedUpAfter int     `json:"speed_up_after"`
+}
+
+// DefaultRateLimit keeps the pace of the old fixed 1500 ms checkout throttle, but
+// lets a burst of 4 requests through at once, e.g. the ones made at login
+var DefaultRateLimit RateLimit = RateLimit{
+	Rate:         1 / 1.5,
+	Burst:        4,
+	MinRate:      0.1,
+	SpeedUpAfter: 10,
+}
+
+type limiter struct {
+	mu     sync.Mutex
+	cfg    RateLimit
+	rate   float64
+	tokens float64
+	last   time.Time
+	streak int
+	now    func() time.Time
+}
+
+func newLimiter(cfg RateLimit, now func() time.Time) *limiter {
+	l := &limiter{now: now}
+	l.configure(cfg)
+	return l
+}
+
+func (l *limiter) configure(cfg RateLimit) {
+	if cfg.Burst < 1 {
+		cfg.Burst = 1
+	}
+	if cfg.MinRate <= 0 || cfg.MinRate > cfg.Rate {
+		cfg.MinRate = cfg.Rate
+	}
+	if cfg.SpeedUpAfter < 1 {
+		cfg.SpeedUpAfter = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	l.rate = cfg.Rate
+	l.tokens = float64(cfg.Burst)
+	l.last = l.now()
+	l.streak = 0
+}
+
+// refill must be called with mu held
+func (l *limiter) refill() {
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.cfg.Burst) {
+		l.tokens = float64(l.cfg.Burst)
+	}
+	l.last = now
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *limiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.cfg.Rate <= 0 {
+			// limiting disabled
+			l.mu.Unlock()
+			return nil
+		}
+		l.refill()
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Feedback adapts the current rate to how Nebula answered the last request
+func (l *limiter) Feedback(status int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cfg.Rate <= 0 || err != nil {
+		return
+	}
+	if status == http.StatusTooManyRequests || status >= 500 {
+		l.streak = 0
+		l.rate /= 2
+		if l.rate < l.cfg.MinRate {
+			l.rate = l.cfg.MinRate
+		}
+		// drain the bucket so the slowdown applies right away
+		l.refill()
+		l.tokens = 0
+		return
+	}
+	l.streak++
+	if l.streak >= l.cfg.SpeedUpAfter && l.rate < l.cfg.Rate {
+		l.streak = 0
+		l.refill()
+		l.rate *= 1.5
+		if l.rate > l.cfg.Rate {
+			l.rate = l.cfg.Rate
+		}
+	}
+}
+
+func (l *limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+func WithRateLimit(rl RateLimit) Option {
+	return func(c *Client) {
+		c.limiter.configure(rl)
+	}
+}
+
+// SetRateLimit replaces the request budget shared by every call the client makes
+func (c *Client) SetRateLimit(rl RateLimit) {
+	c.limiter.configure(rl)
+}
+
+func (c *Client) RateLimit() RateLimit {
+	c.limiter.mu.Lock()
+	defer c.limiter.mu.Unlock()
+	return c.limiter.cfg
+}
+
+// CurrentRate reports the adaptive rate in requests per second
+func (c *Client) CurrentRate() float64 {
+	return c.limiter.Rate()
+}
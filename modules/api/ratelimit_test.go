@@ -0,0 +1,42 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestRateLimitSpacesRequests(t *testing.T) {
+	_, c := loggedIn(t, nil)
+	c.SetRateLimit(api.RateLimit{Rate: 50, Burst: 1})
+
+	// three wallet requests, the first one on the burst
+	start := time.Now()
+	if err := c.UpdateWallets(context.Background()); err != nil {
+		t.Fatalf("wallets failed: %v", err)
+	}
+	if took := time.Since(start); took < 35*time.Millisecond {
+		t.Errorf("three requests took %v, want them 20ms apart", took)
+	}
+}
+
+func TestRateLimitBacksOff(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	c.SetRateLimit(api.RateLimit{Rate: 1000, Burst: 10, MinRate: 100, SpeedUpAfter: 100})
+	mock.FailNext(nebulamock.RouteWallet, nebulamock.Failure{Status: 503}, 2)
+
+	if err := c.UpdateWallets(context.Background()); err != nil {
+		t.Fatalf("wallets failed: %v", err)
+	}
+	if got := c.CurrentRate(); got != 250 {
+		t.Errorf("rate %v after two 503s, want it halved twice to 250", got)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides how often and how long apicall waits before repeating a request.
+// GETs are retried on any transient failure; other methods only when Nebula
+// clearly did not process the request (rate limited, unavailable, failed dial).
+// A gateway error on an order proves nothing, so resending it could buy twice.
+type RetryPolicy struct {
+	MaxAttempts   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	MaxRetryAfter time.Duration
+}
+
+var DefaultRetryPolicy RetryPolicy = RetryPolicy{
+	MaxAttempts:   4,
+	BaseDelay:     500 * time.Millisecond,
+	MaxDelay:      10 * time.Second,
+	MaxRetryAfter: time.Minute,
+}
+
+// RetryInfo describes a failed attempt that is about to be repeated
+type RetryInfo struct {
+	Attempt     int
+	MaxAttempts int
+	Wait        time.Duration
+	Status      int
+	Err         error
+}
+
+type retryObserverKey struct{}
+
+// WithRetryObserver attaches fn to ctx; it is called before every retry of a request made with ctx
+func WithRetryObserver(ctx context.Context, fn func(RetryInfo)) context.Context {
+	return context.WithValue(ctx, retryObserverKey{}, fn)
+}
+
+func notifyRetry(ctx context.Context, ri RetryInfo) {
+	if fn, ok := ctx.Value(retryObserverKey{}).(func(RetryInfo)); ok {
+		fn(ri)
+	}
+}
+
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+func (p RetryPolicy) shouldRetry(method string, status int, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+		if method == http.MethodGet {
+			return true
+		}
+		return dialFailed(err)
+	}
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return method == http.MethodGet
+	}
+	return false
+}
+
+// dialFailed tells a request that never left the machine apart from one lost on the way
+func dialFailed(err error) bool {
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// backoff returns the wait before the next attempt, preferring server hints over
+// jittered exponential delay. ok is false when the server asks for a longer pause
+// than the policy is willing to wait.
+func (p RetryPolicy) backoff(attempt int, h http.Header, now time.Time) (time.Duration, bool) {
+	if d, found := retryAfter(h, now); found {
+		return d, d <= p.MaxRetryAfter
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	// equal jitter keeps at least half of the delay
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// retryAfter reads Retry-After (seconds or HTTP date) and the common rate-limit reset headers
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+			return time.Duration(s) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := t.Sub(now); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+	}
+	for _, k := range []string{"X-RateLimit-Reset", "X-Ratelimit-Retry-After"} {
+		v := h.Get(k)
+		if v == "" {
+			continue
+		}
+		s, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || s < 0 {
+			continue
+		}
+		// large values are unix timestamps, small ones a delay in seconds
+		if s > 1000000000 {
+			if d := time.Unix(s, 0).Sub(now); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+		return time.Duration(s) * time.Second, true
+	}
+	return 0, false
+}
@@ -0,0 +1,125 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestGetRetriedOnGatewayErrors(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.FailNext(nebulamock.RouteWallet, nebulamock.Failure{Status: 502}, 1)
+	mock.FailNext(nebulamock.RouteWallet, nebulamock.Failure{Status: 504}, 1)
+	before := mock.Hits(nebulamock.RouteWallet)
+
+	retries := 0
+	ctx := api.WithRetryObserver(context.Background(), func(api.RetryInfo) {
+		retries++
+	})
+	if err := c.UpdateWallets(ctx); err != nil {
+		t.Fatalf("wallets failed: %v", err)
+	}
+	if retries != 2 {
+		t.Errorf("%d retries, want 2", retries)
+	}
+	// three wallets and the two failed attempts
+	if got := mock.Hits(nebulamock.RouteWallet) - before; got != 5 {
+		t.Errorf("%d wallet requests, want 5", got)
+	}
+}
+
+func TestPostNotResentAfterGatewayError(t *testing.T) {
+	for name, f := range map[string]nebulamock.Failure{
+		"502":     {Status: 502},
+		"504":     {Status: 504},
+		"dropped": {Drop: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock, c := loggedIn(t, nil)
+			line := orderLine(t, c, ammo_bag, "CASH", 1)
+			mock.FailNext(nebulamock.RouteOrders, f, 1)
+
+			_, err := c.ExecOrder(context.Background(), line)
+			if err == nil {
+				t.Fatal("the order went through a failure")
+			}
+			if got := mock.Hits(nebulamock.RouteOrders); got != 1 {
+				t.Errorf("%d order requests, want exactly 1", got)
+			}
+			if len(mock.Orders(nebulamock.DefaultUserId)) != 0 {
+				t.Error("an order was placed")
+			}
+			var uo *api.UnknownOutcomeError
+			if !errors.As(err, &uo) {
+				t.Errorf("got %v, want an UnknownOutcomeError", err)
+			}
+		})
+	}
+}
+
+func TestPostTimeoutIsUnknownOutcome(t *testing.T) {
+	mock, url := startMock(t)
+	c := api.NewClient(append(fastOptions(), api.WithBaseURL(url), api.WithTimeout(100*time.Millisecond))...)
+	t.Cleanup(c.Disconnect)
+	if err := c.Init(context.Background(), nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberNothing); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	line := orderLine(t, c, ammo_bag, "CASH", 1)
+	mock.SetLatency(nebulamock.RouteOrders, 500*time.Millisecond)
+
+	_, err := c.ExecOrder(context.Background(), line)
+	var uo *api.UnknownOutcomeError
+	if !errors.As(err, &uo) {
+		t.Fatalf("got %v, want an UnknownOutcomeError", err)
+	}
+	if got := mock.Hits(nebulamock.RouteOrders); got != 1 {
+		t.Errorf("%d order requests, want exactly 1", got)
+	}
+}
+
+func TestPostRetriedWhenNotProcessed(t *testing.T) {
+	for name, f := range map[string]nebulamock.Failure{
+		"429": {Status: 429, ErrorCode: api.ErrCodeTooManyRequests},
+		"503": {Status: 503},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock, c := loggedIn(t, nil)
+			line := orderLine(t, c, ammo_bag, "CASH", 1)
+			mock.FailNext(nebulamock.RouteOrders, f, 1)
+
+			if _, err := c.ExecOrder(context.Background(), line); err != nil {
+				t.Fatalf("order failed: %v", err)
+			}
+			if got := mock.Hits(nebulamock.RouteOrders); got != 2 {
+				t.Errorf("%d order requests, want 2", got)
+			}
+			if got := len(mock.Orders(nebulamock.DefaultUserId)); got != 1 {
+				t.Errorf("%d orders placed, want 1", got)
+			}
+		})
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	mock, c := loggedIn(t, nil)
+	mock.FailNext(nebulamock.RouteWallet, nebulamock.Failure{Status: 500}, 4)
+	before := mock.Hits(nebulamock.RouteWallet)
+
+	err := c.UpdateWallets(context.Background())
+	var se *api.ServerError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want a ServerError", err)
+	}
+	if got := mock.Hits(nebulamock.RouteWallet) - before; got != 4 {
+		t.Errorf("%d wallet requests, want the 4 attempts of the policy", got)
+	}
+}
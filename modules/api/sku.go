@@ -0,0 +1,79 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SKU categories the shop knows how to group
+const (
+	SkuPreplanning string = "preplanning"
+	SkuCoin        string = "coin"
+	SkuCredits     string = "credits"
+	// preplanning assets any heist can use
+	SkuUniversalGroup string = "uni"
+)
+
+// SKU is a parsed item SKU, <game>_<category>_<variant> or, for preplanning
+// assets, <game>_preplanning_<group>_<variant>
+type SKU struct {
+	Raw      string
+	Game     string
+	Category string
+	// heist the asset belongs to, or SkuUniversalGroup; empty outside preplanning
+	Group   string
+	Variant string
+	// Variant as a number when it is one, 0 otherwise
+	Index int
+}
+
+// SKUError tells why a SKU could not be parsed
+type SKUError struct {
+	Sku    string
+	Reason string
+}
+
+func (e *SKUError) Error() string {
+	return fmt.Sprintf("malformed SKU %q: %s", e.Sku, e.Reason)
+}
+
+var sku_segment = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// ParseSKU splits a SKU into its parts. Any shape other than the two above is an error.
+func ParseSKU(s string) (SKU, error) {
+	if s == "" {
+		return SKU{}, &SKUError{Sku: s, Reason: "empty"}
+	}
+	parts := strings.Split(s, "_")
+	if len(parts) < 3 {
+		return SKU{}, &SKUError{Sku: s, Reason: "expected at least 3 segments separated by '_'"}
+	}
+	for _, p := range parts {
+		if !sku_segment.MatchString(p) {
+			return SKU{}, &SKUError{Sku: s, Reason: "segments must be lowercase letters and digits"}
+		}
+	}
+
+	sku := SKU{Raw: s, Game: parts[0], Category: parts[1], Variant: strings.Join(parts[2:], "_")}
+	if sku.Category == SkuPreplanning {
+		if len(parts) != 4 {
+			return SKU{}, &SKUError{Sku: s, Reason: "preplanning SKUs are <game>_preplanning_<group>_<variant>"}
+		}
+		sku.Group, sku.Variant = parts[2], parts[3]
+	}
+	if n, err := strconv.Atoi(sku.Variant); err == nil {
+		sku.Index = n
+	}
+	return sku, nil
+}
+
+func (s SKU) String() string {
+	return s.Raw
+}
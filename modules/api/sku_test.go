@@ -0,0 +1,70 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"errors"
+	"testing"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestParseSKU(t *testing.T) {
+	for in, want := range map[string]api.SKU{
+		"pd3_preplanning_uni_ammobag": {Raw: "pd3_preplanning_uni_ammobag", Game: "pd3", Category: api.SkuPreplanning, Group: api.SkuUniversalGroup, Variant: "ammobag"},
+		"pd3_preplanning_heist1_2":    {Raw: "pd3_preplanning_heist1_2", Game: "pd3", Category: api.SkuPreplanning, Group: "heist1", Variant: "2", Index: 2},
+		"pd3_credits_1000":            {Raw: "pd3_credits_1000", Game: "pd3", Category: api.SkuCredits, Variant: "1000", Index: 1000},
+		"pd3_coin_pack_small":         {Raw: "pd3_coin_pack_small", Game: "pd3", Category: api.SkuCoin, Variant: "pack_small"},
+	} {
+		got, err := api.ParseSKU(in)
+		if err != nil {
+			t.Errorf("ParseSKU(%q): %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseSKU(%q) = %+v, want %+v", in, got, want)
+		}
+	}
+}
+
+func TestParseSKURejectsMalformed(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"pd3_ammobag",
+		"pd3_Preplanning_uni_ammobag",
+		"pd3__uni",
+		"pd3_preplanning_ammobag",
+		"pd3_preplanning_uni_ammo_bag",
+	} {
+		_, err := api.ParseSKU(in)
+		var se *api.SKUError
+		if !errors.As(err, &se) {
+			t.Errorf("ParseSKU(%q) = %v, want a SKUError", in, err)
+		}
+	}
+}
+
+func TestMalformedAssetsRejected(t *testing.T) {
+	items := nebulamock.DefaultCatalog()
+	items = append(items, nebulamock.NewItem("pd3_preplanning_Bad_1", "Bad", "/PreplanningAssets", "CASH", 1000, 1000))
+	cat := api.NewCatalog(items)
+
+	rejected := cat.Rejected()
+	if len(rejected) != 1 || rejected[0].Sku != "pd3_preplanning_Bad_1" {
+		t.Fatalf("rejected %v, want the malformed asset", rejected)
+	}
+	for _, g := range cat.AssetBank() {
+		for _, v := range g.Items {
+			if v.Sku == "pd3_preplanning_Bad_1" {
+				t.Error("a malformed asset made it into the bank")
+			}
+		}
+	}
+	if cat.Len() != len(items)-1 {
+		t.Errorf("%d items in the catalog, want all but the malformed one", cat.Len())
+	}
+}
@@ -0,0 +1,267 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const LoginFile string = "payshop3_logindata.json"
+
+var ErrWrongPassphrase error = errors.New("wrong passphrase or damaged login file")
+
+// Remember decides what is kept in the session store between runs
+type Remember int
+
+const (
+	// RememberNothing keeps the session in memory only
+	RememberNothing Remember = iota
+	// RememberSession keeps the refresh token and AuthTrustId, but never the password
+	RememberSession
+	// RememberPassword also keeps the login and password for when the refresh token dies
+	RememberPassword
+)
+
+// SessionStore keeps the session between runs of the app
+type SessionStore interface {
+	Load() (LoginData, error)
+	Save(ld LoginData) error
+	Clear() error
+}
+
+// sealedFile is the on-disk envelope of an encrypted login file
+type sealedFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Argon2id parameters for new files, as recommended by RFC 9106 for memory constrained setups
+const (
+	argonTime    uint32 = 3
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 4
+	// files asking for more memory are refused rather than allowed to exhaust it, 1 GiB
+	argonMaxMemory uint32 = 1024 * 1024
+)
+
+// EncryptedFileStore seals the session with AES-GCM under a key derived from
+// the user passphrase. The derived key is cached, so token refreshes do not
+// pay for the key derivation again.
+type EncryptedFileStore struct {
+	Path string
+
+	mu         sync.Mutex
+	passphrase []byte
+	// the cached key and the parameters it was derived with, written back by Save
+	salt    []byte
+	time    uint32
+	memory  uint32
+	threads uint8
+	key     []byte
+}
+
+func NewEncryptedFileStore(path string, passphrase string) *EncryptedFileStore {
+	return &EncryptedFileStore{Path: path, passphrase: []byte(passphrase)}
+}
+
+func (s *EncryptedFileStore) Load() (LoginData, error) {
+	raw, err := os.ReadFile(s.Path)
+	if err != nil {
+		return LoginData{}, err
+	}
+	var sf sealedFile
+	if err := json.Unmarshal(raw, &sf); err != nil || sf.Version != 1 || sf.KDF != "argon2id" {
+		return LoginData{}, fmt.Errorf("%s is not an encrypted login file", s.Path)
+	}
+	if sf.Time == 0 || sf.Threads == 0 || sf.Memory > argonMaxMemory {
+		return LoginData{}, fmt.Errorf("%s asks for unsupported key derivation settings", s.Path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := argon2.IDKey(s.passphrase, sf.Salt, sf.Time, sf.Memory, sf.Threads, 32)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return LoginData{}, err
+	}
+	plain, err := gcm.Open(nil, sf.Nonce, sf.Data, nil)
+	if err != nil {
+		return LoginData{}, ErrWrongPassphrase
+	}
+	var ld LoginData
+	if err := json.Unmarshal(plain, &ld); err != nil {
+		return LoginData{}, ErrWrongPassphrase
+	}
+	s.salt, s.time, s.memory, s.threads = sf.Salt, sf.Time, sf.Memory, sf.Threads
+	s.key = key
+	return ld, nil
+}
+
+func (s *EncryptedFileStore) Save(ld LoginData) error {
+	plain, err := json.Marshal(ld)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.key == nil {
+		s.salt = make([]byte, 16)
+		if _, err := rand.Read(s.salt); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.time, s.memory, s.threads = argonTime, argonMemory, argonThreads
+		s.key = argon2.IDKey(s.passphrase, s.salt, s.time, s.memory, s.threads, 32)
+	}
+	sf := sealedFile{
+		Version: 1,
+		KDF:     "argon2id",
+		Time:    s.time,
+		Memory:  s.memory,
+		Threads: s.threads,
+		Salt:    s.salt,
+	}
+	key := s.key
+	s.mu.Unlock()
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sf.Nonce = nonce
+	sf.Data = gcm.Seal(nil, nonce, plain, nil)
+	out, err := json.Marshal(sf)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.Path, out)
+}
+
+// sibling opens another login file with the same passphrase
+func (s *EncryptedFileStore) sibling(path string) *EncryptedFileStore {
+	return &EncryptedFileStore{Path: path, passphrase: s.passphrase}
+}
+
+func (s *EncryptedFileStore) Clear() error {
+	err := os.Remove(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// WriteFileAtomic replaces path with data through a private temp file in the same directory,
+// so a crash leaves either the old file or the new one, readable by the owner only
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".payshop3-*.tmp")
+	if err != nil {
+		return err
+	}
+	name := tmp.Name()
+	defer os.Remove(name)
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(name, path)
+}
+
+// IsEncryptedLoginFile tells a sealed login file apart from the plaintext format of older versions
+func IsEncryptedLoginFile(path string) (bool, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var sf sealedFile
+	if err := json.Unmarshal(raw, &sf); err != nil {
+		return false, err
+	}
+	return sf.Version != 0 && sf.KDF != "", nil
+}
+
+// ReadPlainLoginFile reads a login file written by versions without encryption
+func ReadPlainLoginFile(path string) (LoginData, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return LoginData{}, err
+	}
+	var ld LoginData
+	err = json.Unmarshal(raw, &ld)
+	return ld, err
+}
+
+func WithSessionStore(s SessionStore) Option {
+	return func(c *Client) {
+		c.store = s
+	}
+}
+
+// SetSessionStore decides where Init and token refreshes save the session when asked to
+func (c *Client) SetSessionStore(s SessionStore) {
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+	c.store = s
+}
+
+func (c *Client) sessionStore() SessionStore {
+	c.storeMu.Lock()
+	defer c.storeMu.Unlock()
+	return c.store
+}
+
+// forget removes the saved session
+func (c *Client) forget() {
+	if s := c.sessionStore(); s != nil {
+		if err := s.Clear(); err != nil {
+			c.log.Printf("saved session not removed: %v", err)
+		}
+		return
+	}
+	// plaintext file of older versions
+	if err := os.Remove(LoginFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.log.Printf("saved session not removed: %v", err)
+	}
+}
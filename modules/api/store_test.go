@@ -0,0 +1,184 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+
+	"payshop3/api"
+	"payshop3/nebulamock"
+)
+
+func TestEncryptedStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), api.LoginFile)
+	ld := api.LoginData{Login: "heister", Password: "hunter2", Token: "token", RefreshToken: "refresh"}
+
+	if err := api.NewEncryptedFileStore(path, "passphrase").Save(ld); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("hunter2")) || bytes.Contains(raw, []byte("refresh")) {
+		t.Error("the login file holds the secrets in plain text")
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode().Perm() != 0600 {
+		t.Errorf("login file mode %v, want 0600", fi.Mode().Perm())
+	}
+	if enc, err := api.IsEncryptedLoginFile(path); err != nil || !enc {
+		t.Errorf("not recognized as encrypted: %v", err)
+	}
+
+	got, err := api.NewEncryptedFileStore(path, "passphrase").Load()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got.Password != ld.Password || got.RefreshToken != ld.RefreshToken {
+		t.Errorf("loaded %+v, want %+v", got, ld)
+	}
+
+	_, err = api.NewEncryptedFileStore(path, "wrong").Load()
+	if !errors.Is(err, api.ErrWrongPassphrase) {
+		t.Errorf("got %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestInitSavesThroughStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), api.LoginFile)
+	_, url := startMock(t)
+	c := api.NewClient(append(fastOptions(), api.WithBaseURL(url), api.WithSessionStore(api.NewEncryptedFileStore(path, "passphrase")))...)
+
+	if err := c.Init(context.Background(), nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberPassword); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	ld, err := api.NewEncryptedFileStore(path, "passphrase").Load()
+	if err != nil {
+		t.Fatalf("no saved session: %v", err)
+	}
+	if ld.UserId != nebulamock.DefaultUserId {
+		t.Errorf("saved user id %q, want %q", ld.UserId, nebulamock.DefaultUserId)
+	}
+}
+
+func TestFailedLoadNotSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), api.LoginFile)
+	mock, url := startMock(t)
+	mock.FailNext(nebulamock.RouteWallet, nebulamock.Failure{Status: 500}, 100)
+	c := api.NewClient(append(fastOptions(), api.WithBaseURL(url), api.WithSessionStore(api.NewEncryptedFileStore(path, "passphrase")))...)
+
+	if err := c.Init(context.Background(), nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberPassword); err == nil {
+		t.Fatal("logged in without wallets")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the failed login was saved: %v", err)
+	}
+}
+
+func TestRememberSessionKeepsNoPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), api.LoginFile)
+	_, url := startMock(t)
+	c := api.NewClient(append(fastOptions(), api.WithBaseURL(url), api.WithSessionStore(api.NewEncryptedFileStore(path, "passphrase")))...)
+
+	if err := c.Init(context.Background(), nebulamock.DefaultLogin, nebulamock.DefaultPassword, api.RememberSession); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	ld, err := api.NewEncryptedFileStore(path, "passphrase").Load()
+	if err != nil {
+		t.Fatalf("no saved session: %v", err)
+	}
+	if ld.Login != "" || ld.Password != "" {
+		t.Error("the saved session holds the credentials")
+	}
+	if ld.RefreshToken == "" {
+		t.Error("the saved session has no refresh token")
+	}
+}
+
+// sealWith writes a login file the way Save does, but with the given key derivation settings
+func sealWith(t *testing.T, path string, passphrase string, time uint32, memory uint32, threads uint8, ld api.LoginData) {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	block, err := aes.NewCipher(argon2.IDKey([]byte(passphrase), salt, time, memory, threads, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := json.Marshal(ld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	raw, err := json.Marshal(map[string]any{
+		"version": 1, "kdf": "argon2id", "time": time, "memory": memory, "threads": threads,
+		"salt": salt, "nonce": nonce, "data": gcm.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreKeepsKeySettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), api.LoginFile)
+	sealWith(t, path, "passphrase", 1, 8*1024, 1, api.LoginData{RefreshToken: "refresh"})
+
+	s := api.NewEncryptedFileStore(path, "passphrase")
+	if _, err := s.Load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if err := s.Save(api.LoginData{RefreshToken: "renewed"}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	var sf struct {
+		Time    uint32 `json:"time"`
+		Memory  uint32 `json:"memory"`
+		Threads uint8  `json:"threads"`
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(raw, &sf) != nil {
+		t.Fatalf("unreadable login file: %v", err)
+	}
+	if sf.Time != 1 || sf.Memory != 8*1024 || sf.Threads != 1 {
+		t.Errorf("saved with %+v, want the settings the cached key was derived with", sf)
+	}
+	ld, err := api.NewEncryptedFileStore(path, "passphrase").Load()
+	if err != nil || ld.RefreshToken != "renewed" {
+		t.Errorf("reloaded %+v, %v", ld, err)
+	}
+}
+
+func TestStoreRefusesOversizedKeySettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), api.LoginFile)
+	raw, _ := json.Marshal(map[string]any{
+		"version": 1, "kdf": "argon2id", "time": 1, "memory": 64 * 1024 * 1024, "threads": 1,
+		"salt": []byte("salt"), "nonce": []byte("nonce"), "data": []byte("data"),
+	})
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := api.NewEncryptedFileStore(path, "passphrase").Load()
+	if err == nil || errors.Is(err, api.ErrWrongPassphrase) {
+		t.Errorf("got %v, want the settings refused", err)
+	}
+}
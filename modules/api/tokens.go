@@ -0,0 +1,363 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// refresh this long before the access token expires
+	refreshMargin time.Duration = 2 * time.Minute
+	// wait before retrying a failed background refresh
+	refreshRetry time.Duration = 30 * time.Second
+)
+
+// tokenManager owns the session of a Client. Every read and write of the
+// tokens goes through mu; background refreshes are timed from the exp claim
+// and concurrent refreshes collapse into a single request.
+type tokenManager struct {
+	c *Client
+
+	mu       sync.Mutex
+	ld       LoginData
+	remember Remember
+	active   bool
+	timer    *time.Timer
+	inflight *refreshCall
+}
+
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+func (m *tokenManager) session() LoginData {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ld
+}
+
+func (m *tokenManager) isActive() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active
+}
+
+// start installs a freshly issued session and schedules its refresh
+func (m *tokenManager) start(ld LoginData, remember Remember) {
+	m.mu.Lock()
+	m.ld = ld
+	m.remember = remember
+	m.active = true
+	m.scheduleLocked()
+	m.mu.Unlock()
+	m.c.persist(ld, remember)
+}
+
+// stop forgets the session and cancels the refresh timer. A refresh that is
+// still in flight finishes, but its result is discarded.
+func (m *tokenManager) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = false
+	m.ld = LoginData{}
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
+
+// expiryLocked prefers the exp claim and falls back to the TTL reported with the token
+func (m *tokenManager) expiryLocked() (time.Time, bool) {
+	if exp, ok := m.c.tokenExpiry(m.ld.Token); ok {
+		return exp, true
+	}
+	if m.ld.TokenTTL > 0 && !m.ld.TokenUpdatedAt.IsZero() {
+		return m.ld.TokenUpdatedAt.Add(time.Duration(m.ld.TokenTTL) * time.Second), true
+	}
+	return time.Time{}, false
+}
+
+func (m *tokenManager) scheduleLocked() {
+	d := time.Minute
+	if exp, ok := m.expiryLocked(); ok {
+		d = exp.Sub(m.c.now()) - refreshMargin
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+	m.armLocked(d)
+}
+
+func (m *tokenManager) armLocked(d time.Duration) {
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	if !m.active {
+		return
+	}
+	m.timer = time.AfterFunc(d, func() {
+		err := m.refresh(context.Background(), "")
+		if err == nil {
+			return
+		}
+		var ae *AuthError
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if !errors.As(err, &ae) {
+			// transient failure, the session may still be alive
+			m.armLocked(refreshRetry)
+		}
+	})
+}
+
+func (m *tokenManager) needsRefreshLocked() bool {
+	exp, ok := m.expiryLocked()
+	return ok && exp.Sub(m.c.now()) < refreshMargin
+}
+
+// refresh renews the session when the access token is close to expiry.
+// A non-empty stale token forces the refresh unless the session already moved past it.
+// Callers arriving while a refresh is in flight wait for that one instead of starting another.
+func (m *tokenManager) refresh(ctx context.Context, stale string) error {
+	m.mu.Lock()
+	if !m.active {
+		m.mu.Unlock()
+		return &AuthError{APIError{Message: "not logged in"}}
+	}
+	if call := m.inflight; call != nil {
+		m.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if stale != "" && stale != m.ld.Token {
+		m.mu.Unlock()
+		return nil
+	}
+	if stale == "" && !m.needsRefreshLocked() {
+		m.scheduleLocked()
+		m.mu.Unlock()
+		return nil
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	m.inflight = call
+	old := m.ld
+	m.mu.Unlock()
+
+	// shared by every waiter, so it must not die with the first caller's context
+	ld, err := m.c.renew(context.Background(), old)
+
+	m.mu.Lock()
+	m.inflight = nil
+	remember := m.remember
+	current := m.active && m.ld.Token == old.Token
+	if err == nil && current {
+		m.ld = ld
+		m.scheduleLocked()
+	}
+	m.mu.Unlock()
+	if err == nil && current {
+		m.c.persist(ld, remember)
+	}
+
+	call.err = err
+	close(call.done)
+	return err
+}
+
+// ensureFresh refreshes the session before an authenticated request if it is about to expire
+func (m *tokenManager) ensureFresh(ctx context.Context) error {
+	m.mu.Lock()
+	due := m.active && m.needsRefreshLocked()
+	m.mu.Unlock()
+	if !due {
+		return nil
+	}
+	return m.refresh(ctx, "")
+}
+
+// Session returns a copy of the current login data
+func (c *Client) Session() LoginData {
+	return c.tokens.session()
+}
+
+func (c *Client) LoggedIn() bool {
+	return c.tokens.isActive()
+}
+
+// UpdateTokenInfo renews the session now if it is close to expiry, or unconditionally with force
+func (c *Client) UpdateTokenInfo(ctx context.Context, force bool) error {
+	stale := ""
+	if force {
+		stale = c.tokens.session().Token
+	}
+	return c.tokens.refresh(ctx, stale)
+}
+
+// renew exchanges the refresh token for a new session, falling back to the
+// stored credentials when the refresh token is dead
+func (c *Client) renew(ctx context.Context, old LoginData) (LoginData, error) {
+	var err error
+	if c.refreshAlive(old) {
+		var ld LoginData
+		ld, err = c.tokenGrant(ctx, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {old.RefreshToken},
+		}, old.AuthTrustId)
+		if err == nil {
+			return carrySession(ld, old), nil
+		}
+	}
+	if old.Login == "" || old.Password == "" {
+		if err == nil {
+			err = &AuthError{APIError{Message: "session expired, please log in again"}}
+		}
+		return LoginData{}, err
+	}
+	ld, err := c.passwordGrant(ctx, old.Login, old.Password, old.AuthTrustId)
+	var mfa *MFARequiredError
+	if errors.As(err, &mfa) {
+		// nobody is around to type the code in the background
+		return LoginData{}, &AuthError{APIError{Status: mfa.Status, Message: "session expired, please log in again with your second factor"}}
+	}
+	if err != nil {
+		return LoginData{}, err
+	}
+	return carrySession(ld, old), nil
+}
+
+// refreshAlive tells whether the refresh token is worth a try. Tokens that are
+// not JWTs are judged by the TTL they came with, or left to the server to reject.
+func (c *Client) refreshAlive(ld LoginData) bool {
+	if ld.RefreshToken == "" {
+		return false
+	}
+	if exp, ok := c.tokenExpiry(ld.RefreshToken); ok {
+		return exp.After(c.now())
+	}
+	if ld.RefreshTokenTTL > 0 && !ld.RefreshUpdatedAt.IsZero() {
+		return ld.RefreshUpdatedAt.Add(time.Duration(ld.RefreshTokenTTL) * time.Second).After(c.now())
+	}
+	return true
+}
+
+// carrySession keeps the locally tracked fields of the previous session
+func carrySession(ld LoginData, old LoginData) LoginData {
+	ld.Login = old.Login
+	ld.Password = old.Password
+	ld.AutoLogin = old.AutoLogin
+	if ld.AuthTrustId == "" {
+		ld.AuthTrustId = old.AuthTrustId
+	}
+	return ld
+}
+
+func (c *Client) passwordGrant(ctx context.Context, login string, password string, trustId string) (LoginData, error) {
+	ld, err := c.tokenGrant(ctx, url.Values{
+		"grant_type": {"password"},
+		"client_id":  {c.clientID},
+		"username":   {login},
+		"password":   {password},
+		"extend_exp": {"true"},
+	}, trustId)
+	var ae *AuthError
+	if errors.As(err, &ae) {
+		ae.Message = "login or password is incorrect"
+	}
+	return ld, err
+}
+
+// tokenGrant posts to the IAM token endpoint and stamps the result with the local clock.
+// trustId is the AuthTrustId of an earlier login on this device, if there was one.
+func (c *Client) tokenGrant(ctx context.Context, form url.Values, trustId string) (LoginData, error) {
+	return c.issueTokens(ctx, "/iam/v3/oauth/token", form, trustId)
+}
+
+// issueTokens posts a form to an IAM endpoint that answers with a new session
+func (c *Client) issueTokens(ctx context.Context, path string, form url.Values, trustId string) (LoginData, error) {
+	headers := []header{
+		{Key: "Authorization", Value: basic_auth},
+		{Key: "Content-Type", Value: "application/x-www-form-urlencoded;charset=UTF-8"},
+	}
+	if trustId != "" {
+		headers = append(headers, header{Key: "Auth-Trust-Id", Value: trustId})
+	}
+	authResp, err := c.request(ctx, path, "POST", headers, form.Encode(), 200)
+	if err != nil {
+		return LoginData{}, err
+	}
+
+	var ld LoginData
+	err = json.Unmarshal(authResp, &ld)
+	if err != nil || ld.Token == "" {
+		return LoginData{}, errors.New("unexpected server response on attempted auth")
+	}
+	ld.TokenUpdatedAt = c.now()
+	ld.RefreshUpdatedAt = c.now()
+	return ld, nil
+}
+
+// persist hands the session to the session store when the user asked to be remembered
+func (c *Client) persist(ld LoginData, remember Remember) {
+	s := c.sessionStore()
+	if remember == RememberNothing || s == nil {
+		return
+	}
+	if remember == RememberSession {
+		// enough to refresh, useless to log in with
+		ld = LoginData{
+			RefreshToken:     ld.RefreshToken,
+			RefreshTokenTTL:  ld.RefreshTokenTTL,
+			RefreshUpdatedAt: ld.RefreshUpdatedAt,
+			AuthTrustId:      ld.AuthTrustId,
+		}
+	}
+	ld.AutoLogin = true
+	if err := s.Save(ld); err != nil {
+		c.log.Printf("session not saved: %v", err)
+	}
+}
+
+func (c *Client) tokenExpiry(tokenString string) (time.Time, bool) {
+	cl := TokenClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(tokenString, &cl)
+	if err != nil || cl.ExpiresAt == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(*cl.ExpiresAt), 0), true
+}
+
+// GetTimeLeftJWT returns the seconds until the token expires, or 0 if it cannot be read
+func (c *Client) GetTimeLeftJWT(tokenString string) int {
+	exp, ok := c.tokenExpiry(tokenString)
+	if !ok {
+		return 0
+	}
+	return int(exp.Sub(c.now()).Seconds())
+}
+
+// Claims decodes the claims of the current access token without verifying its signature
+func (c *Client) Claims() (TokenClaims, error) {
+	cl := TokenClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(c.Session().Token, &cl)
+	if err != nil {
+		return TokenClaims{}, fmt.Errorf("could not read token claims: %w", err)
+	}
+	return cl, nil
+}
@@ -0,0 +1,166 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package nebulamock
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"payshop3/api"
+)
+
+var defaultHeists []string = []string{
+	"branchbank",
+	"armoredtransport",
+	"jewelrystore",
+	"nightclub",
+	"artgallery",
+	"sharkebank",
+	"cargodock",
+	"penthouse",
+}
+
+// MockItemId derives a stable 32 char item id from the SKU, so ids survive catalog rebuilds
+func MockItemId(sku string) string {
+	h := md5.Sum([]byte(sku))
+	return hex.EncodeToString(h[:])
+}
+
+// NewItem builds a listable, purchasable catalog entry priced in a single currency
+func NewItem(sku string, name string, category string, currency string, price int, discounted int) api.ShopItemData {
+	id := MockItemId(sku)
+	ns := "pd3"
+	status := "ACTIVE"
+	entType := "CONSUMABLE"
+	itemType := "INGAMEITEM"
+	region := "US"
+	lang := "en"
+	t := true
+	useCount := 1
+	created := time.Date(2023, 9, 21, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+
+	currencyType := "VIRTUAL"
+	if currency == "USD" {
+		currencyType = "REAL"
+	}
+	rd := []api.ItemRegionData{{
+		Price:             &price,
+		DiscountedPrice:   &discounted,
+		CurrencyCode:      &currency,
+		CurrencyType:      &currencyType,
+		CurrencyNamespace: &ns,
+	}}
+	if price > 0 && discounted < price {
+		pct := 100 - discounted*100/price
+		amt := price - discounted
+		rd[0].DiscountPercentage = &pct
+		rd[0].DiscountAmount = &amt
+	}
+
+	return api.ShopItemData{
+		Title:           &name,
+		ItemId:          &id,
+		Sku:             &sku,
+		Namespace:       &ns,
+		Name:            &name,
+		EntitlementType: &entType,
+		UseCount:        &useCount,
+		Stackable:       &t,
+		CategoryPath:    &category,
+		Status:          &status,
+		Listable:        &t,
+		Purchasable:     &t,
+		ItemType:        &itemType,
+		RegionData:      &rd,
+		Region:          &region,
+		Language:        &lang,
+		CreatedAt:       &created,
+		UpdatedAt:       &created,
+	}
+}
+
+// DefaultCatalog mirrors the shape of the live pd3 shop: universal bags,
+// four exclusive assets per heist, C-Stack bundles and credit packs.
+func DefaultCatalog() []api.ShopItemData {
+	items := []api.ShopItemData{}
+	for _, b := range []string{"ammobag", "armorbag", "medicbag", "zipline"} {
+		name := map[string]string{
+			"ammobag":  "Ammo Bag",
+			"armorbag": "Armor Bag",
+			"medicbag": "Medic Bag",
+			"zipline":  "Zipline Bag",
+		}[b]
+		items = append(items, NewItem("pd3_preplanning_uni_"+b, name, "/PreplanningAssets", "CASH", 25000, 25000))
+	}
+
+	for _, h := range defaultHeists {
+		for i := 1; i <= 4; i++ {
+			sku := fmt.Sprintf("pd3_preplanning_%s_%d", h, i)
+			items = append(items, NewItem(sku, fmt.Sprintf("%s asset %d", h, i), "/PreplanningAssets", "CASH", 50000, 40000))
+		}
+	}
+
+	for _, g := range []struct {
+		sku   string
+		name  string
+		count int
+		price int
+	}{
+		{"pd3_coin_goldsmall0", "1 C-Stack", 1, 1000000},
+		{"pd3_coin_goldmedium0", "5 C-Stacks", 5, 4750000},
+		{"pd3_coin_goldlarge0", "10 C-Stacks", 10, 9000000},
+	} {
+		it := NewItem(g.sku, g.name, "/Coins", "CASH", g.price, g.price)
+		count := g.count
+		it.UseCount = &count
+		items = append(items, it)
+	}
+
+	for _, cr := range []struct {
+		sku    string
+		name   string
+		amount int
+		price  int
+	}{
+		{"pd3_credits_500", "500 PAYDAY Credits", 500, 499},
+		{"pd3_credits_1100", "1100 PAYDAY Credits", 1100, 999},
+	} {
+		it := NewItem(cr.sku, cr.name, "/Credits", "USD", cr.price, cr.price)
+		target := "CRED"
+		itemType := "COINS"
+		amount := cr.amount
+		it.TargetCurrencyCode = &target
+		it.ItemType = &itemType
+		it.UseCount = &amount
+		items = append(items, it)
+	}
+	return items
+}
+
+// SyntheticCatalog builds a catalog of about n items for load tests: the
+// default catalog plus generated heists with four exclusive assets each and
+// filler items spread over a few categories and tags
+func SyntheticCatalog(n int) []api.ShopItemData {
+	items := DefaultCatalog()
+	categories := []string{"/Cosmetics", "/Weapons", "/Masks", "/Coins"}
+	for h := 0; len(items) < n; h++ {
+		if h%2 == 0 {
+			for i := 1; i <= 4 && len(items) < n; i++ {
+				sku := fmt.Sprintf("pd3_preplanning_synth%d_%d", h, i)
+				items = append(items, NewItem(sku, fmt.Sprintf("synth%d asset %d", h, i), "/PreplanningAssets", "CASH", 50000, 45000))
+			}
+			continue
+		}
+		sku := fmt.Sprintf("pd3_filler_%d", h)
+		it := NewItem(sku, fmt.Sprintf("Filler %d", h), categories[h%len(categories)], "CASH", 1000+h, 1000+h)
+		tags := []string{fmt.Sprintf("tag%d", h%16)}
+		it.Tags = &tags
+		items = append(items, it)
+	}
+	return items
+}
@@ -0,0 +1,3 @@
+module payshop3/nebulamock
+
+go 1.20
@@ -0,0 +1,1003 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+
+// Package nebulamock is a local stand-in for the handful of Nebula (AccelByte)
+// endpoints payshop3 talks to. It keeps accounts, wallets and orders in memory
+// and can be scripted to fail or slow down, so login, cart building and
+// checkout can be exercised without a real account.
+package nebulamock
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"payshop3/api"
+)
+
+// Route names used to script failures and latency
+const (
+	RouteToken     string = "token"
+	RouteAuthorize string = "authorize"
+	RouteMFA       string = "mfa"
+	RouteRevoke    string = "revoke"
+	RouteCatalog   string = "catalog"
+	RouteWallet    string = "wallet"
+	RouteOrders    string = "orders"
+	// RouteEntitlements lists what the user owns
+	RouteEntitlements string = "entitlements"
+	// RouteOrderHistory lists the orders of the user
+	RouteOrderHistory string = "order history"
+	// RouteOrder is a single order, looked up by its number
+	RouteOrder string = "order"
+)
+
+const (
+	DefaultLogin    string = "heister@example.com"
+	DefaultPassword string = "payday"
+	DefaultUserId   string = "5b1c0e5f7a6d4c3b9e8f1a2b3c4d5e6f"
+)
+
+type Account struct {
+	UserId      string
+	Login       string
+	Password    string
+	DisplayName string
+	Country     string
+	Balances    map[string]int
+	// MFACode turns on the second factor; it is the only code accepted
+	MFACode string
+}
+
+// Failure is a scripted response served instead of the real handler.
+// Drop closes the connection without answering to simulate a network blip.
+type Failure struct {
+	Status       int
+	ErrorCode    int
+	ErrorMessage string
+	Header       map[string]string
+	Drop         bool
+}
+
+type Server struct {
+	Namespace  string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Now        func() time.Time
+	// BrowserLogin is the login of the account the authorize page signs in right away
+	BrowserLogin string
+
+	mu       sync.Mutex
+	secret   []byte
+	items    []api.ShopItemData
+	accounts map[string]*Account
+	access   map[string]string
+	refresh  map[string]string
+	codes    map[string]authCode
+	mfa      map[string]string
+	trusted  map[string]string
+	orders   map[string][]api.OrderRespData
+	owned    map[string][]api.EntitlementData
+	failures map[string][]Failure
+	latency  map[string]time.Duration
+	hits     map[string]int
+	seq      int
+}
+
+// New creates a stand-in server with the default catalog and one funded account
+func New() *Server {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	s := &Server{
+		Namespace:    "pd3",
+		AccessTTL:    time.Hour,
+		RefreshTTL:   24 * time.Hour,
+		Now:          time.Now,
+		BrowserLogin: DefaultLogin,
+		secret:       secret,
+		items:        DefaultCatalog(),
+		accounts:     map[string]*Account{},
+		access:       map[string]string{},
+		refresh:      map[string]string{},
+		codes:        map[string]authCode{},
+		mfa:          map[string]string{},
+		trusted:      map[string]string{},
+		orders:       map[string][]api.OrderRespData{},
+		owned:        map[string][]api.EntitlementData{},
+		failures:     map[string][]Failure{},
+		latency:      map[string]time.Duration{},
+		hits:         map[string]int{},
+	}
+	s.AddAccount(Account{
+		UserId:      DefaultUserId,
+		Login:       DefaultLogin,
+		Password:    DefaultPassword,
+		DisplayName: "MockHeister",
+		Country:     "US",
+		Balances:    map[string]int{"CASH": 50000000, "GOLD": 100, "CRED": 1000},
+	})
+	return s
+}
+
+// Start serves the stand-in on a random loopback port, for use in tests
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) SetCatalog(items []api.ShopItemData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append([]api.ShopItemData{}, items...)
+}
+
+func (s *Server) AddAccount(a Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.Balances == nil {
+		a.Balances = map[string]int{}
+	}
+	s.accounts[a.Login] = &a
+}
+
+func (s *Server) SetBalance(userId string, currency string, balance int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.accountById(userId); a != nil {
+		a.Balances[currency] = balance
+	}
+}
+
+func (s *Server) Balance(userId string, currency string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.accountById(userId); a != nil {
+		return a.Balances[currency]
+	}
+	return 0
+}
+
+// Orders returns every order placed by the user, oldest first
+func (s *Server) Orders(userId string) []api.OrderRespData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]api.OrderRespData{}, s.orders[userId]...)
+}
+
+// Grant gives the user quantity of the item, like a fulfilled order would
+func (s *Server) Grant(userId string, itemId string, quantity int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.items {
+		if s.items[i].ItemId != nil && *s.items[i].ItemId == itemId {
+			s.grantLocked(userId, s.items[i], quantity)
+			return
+		}
+	}
+}
+
+// Entitlements returns what the user owns, oldest first
+func (s *Server) Entitlements(userId string) []api.EntitlementData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]api.EntitlementData{}, s.owned[userId]...)
+}
+
+func (s *Server) grantLocked(userId string, item api.ShopItemData, quantity int) {
+	s.seq++
+	id := fmt.Sprintf("E%06d", s.seq)
+	status := "ACTIVE"
+	clazz := "ENTITLEMENT"
+	source := "PURCHASE"
+	now := s.Now().UTC()
+	useCount := quantity
+	if item.UseCount != nil {
+		useCount = *item.UseCount * quantity
+	}
+	s.owned[userId] = append(s.owned[userId], api.EntitlementData{
+		Id:        &id,
+		Namespace: &s.Namespace,
+		Clazz:     &clazz,
+		Type:      item.EntitlementType,
+		Status:    &status,
+		Sku:       item.Sku,
+		UserId:    &userId,
+		ItemId:    item.ItemId,
+		Name:      item.Name,
+		UseCount:  &useCount,
+		Quantity:  &quantity,
+		Source:    &source,
+		Stackable: item.Stackable,
+		GrantedAt: &now,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	})
+}
+
+func (s *Server) ownedLocked(userId string, itemId string) int {
+	n := 0
+	for _, e := range s.owned[userId] {
+		if e.ItemId != nil && *e.ItemId == itemId && e.Quantity != nil {
+			n += *e.Quantity
+		}
+	}
+	return n
+}
+
+// SetOrderStatus moves an order on, like a payment or a refund would
+func (s *Server) SetOrderStatus(userId string, orderNo string, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, o := range s.orders[userId] {
+		if *o.OrderNo == orderNo {
+			now := s.Now().UTC()
+			if status == "FULFILLED" && *o.Status != status && o.ItemSnapshot != nil {
+				s.grantLocked(userId, *o.ItemSnapshot, *o.Quantity)
+			}
+			s.orders[userId][i].Status = &status
+			s.orders[userId][i].UpdatedAt = &now
+		}
+	}
+}
+
+// expireLocked closes the orders whose payment window has passed
+func (s *Server) expireLocked(userId string) {
+	now := s.Now()
+	for i, o := range s.orders[userId] {
+		if *o.Status == "INIT" && o.ExpireTime != nil && !now.Before(*o.ExpireTime) {
+			closed := "CLOSED"
+			updated := now.UTC()
+			s.orders[userId][i].Status = &closed
+			s.orders[userId][i].UpdatedAt = &updated
+		}
+	}
+}
+
+// FailNext queues f to be served for the next `times` requests on route
+func (s *Server) FailNext(route string, f Failure, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.failures[route] = append(s.failures[route], f)
+	}
+}
+
+// SetLatency delays every request on route by d
+func (s *Server) SetLatency(route string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency[route] = d
+}
+
+// Hits reports how many requests reached route, including scripted failures
+func (s *Server) Hits(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[route]
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, parts := s.match(r)
+	if route == "" {
+		writeError(w, http.StatusNotFound, api.ErrCodeNotFound, fmt.Sprintf("path %s was not found", r.URL.Path))
+		return
+	}
+
+	s.mu.Lock()
+	s.hits[route]++
+	delay := s.latency[route]
+	var fail *Failure
+	if q := s.failures[route]; len(q) > 0 {
+		fail = &q[0]
+		s.failures[route] = q[1:]
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if fail != nil {
+		serveFailure(w, *fail)
+		return
+	}
+
+	switch route {
+	case RouteToken:
+		s.handleToken(w, r)
+	case RouteAuthorize:
+		s.handleAuthorize(w, r)
+	case RouteMFA:
+		s.handleMFA(w, r, parts[0])
+	case RouteRevoke:
+		s.handleRevoke(w, r)
+	case RouteCatalog:
+		s.handleCatalog(w, r)
+	case RouteWallet:
+		s.handleWallet(w, r, parts[0], parts[1])
+	case RouteOrders:
+		s.handleCreateOrder(w, r, parts[0])
+	case RouteEntitlements:
+		s.handleEntitlements(w, r, parts[0])
+	case RouteOrderHistory:
+		s.handleOrderHistory(w, r, parts[0])
+	case RouteOrder:
+		s.handleOrder(w, r, parts[0], parts[1])
+	}
+}
+
+// match resolves the request to a route name and its path parameters
+func (s *Server) match(r *http.Request) (string, []string) {
+	if r.URL.Path == "/iam/v3/oauth/token" && r.Method == http.MethodPost {
+		return RouteToken, nil
+	}
+	if r.URL.Path == "/iam/v3/oauth/authorize" && r.Method == http.MethodGet {
+		return RouteAuthorize, nil
+	}
+	if r.URL.Path == "/iam/v3/oauth/revoke" && r.Method == http.MethodPost {
+		return RouteRevoke, nil
+	}
+	if strings.HasPrefix(r.URL.Path, "/iam/v3/oauth/mfa/") && r.Method == http.MethodPost {
+		return RouteMFA, []string{strings.TrimPrefix(r.URL.Path, "/iam/v3/oauth/mfa/")}
+	}
+	prefix := "/platform/public/namespaces/" + s.Namespace + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		return "", nil
+	}
+	p := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	switch {
+	case len(p) == 2 && p[0] == "items" && p[1] == "byCriteria" && r.Method == http.MethodGet:
+		return RouteCatalog, nil
+	case len(p) == 4 && p[0] == "users" && p[2] == "wallets" && r.Method == http.MethodGet:
+		return RouteWallet, []string{p[1], p[3]}
+	case len(p) == 3 && p[0] == "users" && p[2] == "orders" && r.Method == http.MethodPost:
+		return RouteOrders, []string{p[1]}
+	case len(p) == 3 && p[0] == "users" && p[2] == "orders" && r.Method == http.MethodGet:
+		return RouteOrderHistory, []string{p[1]}
+	case len(p) == 4 && p[0] == "users" && p[2] == "orders" && r.Method == http.MethodGet:
+		return RouteOrder, []string{p[1], p[3]}
+	case len(p) == 3 && p[0] == "users" && p[2] == "entitlements" && r.Method == http.MethodGet:
+		return RouteEntitlements, []string{p[1]}
+	}
+	return "", nil
+}
+
+func serveFailure(w http.ResponseWriter, f Failure) {
+	if f.Drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			conn, _, err := hj.Hijack()
+			if err == nil {
+				conn.Close()
+				return
+			}
+		}
+		f.Status = http.StatusBadGateway
+	}
+	for k, v := range f.Header {
+		w.Header().Set(k, v)
+	}
+	msg := f.ErrorMessage
+	if msg == "" {
+		msg = http.StatusText(f.Status)
+	}
+	writeError(w, f.Status, f.ErrorCode, msg)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code int, msg string) {
+	writeJSON(w, status, api.OrderErrorData{ErrorCode: &code, ErrorMessage: &msg})
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, kind string, desc string) {
+	writeJSON(w, status, map[string]string{"error": kind, "error_description": desc})
+}
+
+func (s *Server) accountById(userId string) *Account {
+	for _, a := range s.accounts {
+		if a.UserId == userId {
+			return a
+		}
+	}
+	return nil
+}
+
+// authorize resolves the bearer token to an account owning userId
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, userId string) *Account {
+	tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	uid, ok := s.access[tok]
+	acc := s.accountById(uid)
+	s.mu.Unlock()
+
+	if !ok || acc == nil || s.tokenExpired(tok) {
+		writeError(w, http.StatusUnauthorized, api.ErrCodeUnauthorized, "unauthorized access")
+		return nil
+	}
+	if userId != "" && userId != uid {
+		writeError(w, http.StatusForbidden, api.ErrCodeForbidden, "insufficient permissions")
+		return nil
+	}
+	return acc
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	s.mu.Lock()
+	var acc *Account
+	switch r.PostForm.Get("grant_type") {
+	case "password":
+		a := s.accounts[r.PostForm.Get("username")]
+		if a != nil && a.Password == r.PostForm.Get("password") {
+			acc = a
+		}
+	case "refresh_token":
+		rt := r.PostForm.Get("refresh_token")
+		if uid, ok := s.refresh[rt]; ok && !s.tokenExpired(rt) {
+			acc = s.accountById(uid)
+			delete(s.refresh, rt)
+		}
+	case "authorization_code":
+		code, ok := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if ok && s.Now().Before(code.expires) &&
+			code.redirect == r.PostForm.Get("redirect_uri") &&
+			code.challenge == base64.RawURLEncoding.EncodeToString(sum[:]) {
+			acc = s.accountById(code.userId)
+		}
+	default:
+		s.mu.Unlock()
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant type is not supported")
+		return
+	}
+	if acc == nil {
+		s.mu.Unlock()
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_grant", "invalid username, password or refresh token")
+		return
+	}
+	trust := r.Header.Get("Auth-Trust-Id")
+	if r.PostForm.Get("grant_type") == "password" && acc.MFACode != "" && s.trusted[trust] != acc.UserId {
+		token := s.randomHex()
+		s.mfa[token] = acc.UserId
+		s.mu.Unlock()
+		writeJSON(w, http.StatusForbidden, map[string]any{
+			"error":             "mfa_required",
+			"error_description": "2FA is enabled for this account",
+			"mfa_token":         token,
+			"factors":           []string{api.FactorAuthenticator, api.FactorBackupCode, api.FactorEmail},
+			"default_factor":    api.FactorAuthenticator,
+		})
+		return
+	}
+	body := s.issueLocked(acc, trust)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, body)
+}
+
+// handleMFA serves the code and verify steps of the second factor
+func (s *Server) handleMFA(w http.ResponseWriter, r *http.Request, step string) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+	s.mu.Lock()
+	token := r.PostForm.Get("mfaToken")
+	acc := s.accountById(s.mfa[token])
+	if acc == nil {
+		s.mu.Unlock()
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_grant", "mfa token is invalid or expired")
+		return
+	}
+	switch step {
+	case "code":
+		// the code would be emailed here
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "verify":
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, api.ErrCodeNotFound, fmt.Sprintf("path %s was not found", r.URL.Path))
+		return
+	}
+	if r.PostForm.Get("code") != acc.MFACode {
+		s.mu.Unlock()
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_grant", "invalid code")
+		return
+	}
+	delete(s.mfa, token)
+	body := s.issueLocked(acc, "")
+	if r.PostForm.Get("rememberDevice") == "true" {
+		s.trusted[body["auth_trust_id"].(string)] = acc.UserId
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, body)
+}
+
+// handleRevoke invalidates an access or refresh token. Unknown tokens are
+// accepted too, as RFC 7009 asks.
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+	tok := r.PostForm.Get("token")
+	if tok == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+	s.mu.Lock()
+	delete(s.access, tok)
+	delete(s.refresh, tok)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// issueLocked creates a session for acc; a known device keeps its trust id
+func (s *Server) issueLocked(acc *Account, trust string) map[string]any {
+	at := s.sign(acc, s.AccessTTL)
+	rt := s.sign(acc, s.RefreshTTL)
+	s.access[at] = acc.UserId
+	s.refresh[rt] = acc.UserId
+	if trust == "" {
+		trust = s.randomHex()
+	}
+	return map[string]any{
+		"access_token":       at,
+		"refresh_token":      rt,
+		"token_type":         "Bearer",
+		"expires_in":         int(s.AccessTTL.Seconds()),
+		"refresh_expires_in": int(s.RefreshTTL.Seconds()),
+		"user_id":            acc.UserId,
+		"display_name":       acc.DisplayName,
+		"namespace":          s.Namespace,
+		"auth_trust_id":      trust,
+	}
+}
+
+func (s *Server) randomHex() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// authCode is an authorization code waiting to be exchanged with its PKCE verifier
+type authCode struct {
+	userId    string
+	challenge string
+	redirect  string
+	expires   time.Time
+}
+
+// handleAuthorize stands in for the IAM login page: it signs BrowserLogin in
+// without asking and redirects back with a code
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme != "http" || (redirect.Hostname() != "127.0.0.1" && redirect.Hostname() != "localhost") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "redirect_uri must point to the loopback interface")
+		return
+	}
+	back := redirect.Query()
+	back.Set("state", q.Get("state"))
+
+	s.mu.Lock()
+	acc := s.accounts[s.BrowserLogin]
+	switch {
+	case q.Get("response_type") != "code":
+		back.Set("error", "unsupported_response_type")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		back.Set("error", "invalid_request")
+		back.Set("error_description", "PKCE with S256 is required")
+	case acc == nil:
+		back.Set("error", "access_denied")
+	default:
+		code := s.randomHex()
+		s.codes[code] = authCode{
+			userId:    acc.UserId,
+			challenge: q.Get("code_challenge"),
+			redirect:  q.Get("redirect_uri"),
+			expires:   s.Now().Add(time.Minute),
+		}
+		back.Set("code", code)
+	}
+	s.mu.Unlock()
+
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// sign issues an HS256 JWT carrying the claims payshop3 reads from tokens
+func (s *Server) sign(acc *Account, ttl time.Duration) string {
+	now := s.Now()
+	s.seq++
+	hdr := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"sub":       acc.UserId,
+		"namespace": s.Namespace,
+		"country":   acc.Country,
+		"iat":       now.Unix(),
+		"exp":       now.Add(ttl).Unix(),
+		"jti":       strconv.Itoa(s.seq),
+	})
+	payload := hdr + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) tokenExpired(tok string) bool {
+	p := strings.Split(tok, ".")
+	if len(p) != 3 {
+		return true
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(p[1])
+	if err != nil {
+		return true
+	}
+	var cl struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(raw, &cl) != nil {
+		return true
+	}
+	return s.Now().Unix() >= cl.Exp
+}
+
+func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	s.mu.Lock()
+	items := s.items
+	if region := q.Get("region"); region != "" {
+		// only what is priced for the region, like a store without it returns nothing
+		items = []api.ShopItemData{}
+		for _, v := range s.items {
+			if v.Region != nil && *v.Region == region {
+				items = append(items, v)
+			}
+		}
+	}
+	total := len(items)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit < total-offset {
+		end = offset + limit
+	}
+	page := append([]api.ShopItemData{}, items[offset:end]...)
+	s.mu.Unlock()
+
+	paging := map[string]string{}
+	if end < total {
+		next := *r.URL
+		nq := next.Query()
+		nq.Set("offset", strconv.Itoa(end))
+		nq.Set("limit", strconv.Itoa(limit))
+		next.RawQuery = nq.Encode()
+		paging["next"] = next.RequestURI()
+	}
+	if offset > 0 {
+		prev := *r.URL
+		pq := prev.Query()
+		po := offset - limit
+		if po < 0 {
+			po = 0
+		}
+		pq.Set("offset", strconv.Itoa(po))
+		pq.Set("limit", strconv.Itoa(limit))
+		prev.RawQuery = pq.Encode()
+		paging["previous"] = prev.RequestURI()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": page, "paging": paging})
+}
+
+func (s *Server) handleEntitlements(w http.ResponseWriter, r *http.Request, userId string) {
+	if s.authorize(w, r, userId) == nil {
+		return
+	}
+	s.mu.Lock()
+	ents := append([]api.EntitlementData{}, s.owned[userId]...)
+	s.mu.Unlock()
+
+	start, end, paging := pageOf(r, len(ents))
+	writeJSON(w, http.StatusOK, map[string]any{"data": ents[start:end], "paging": paging})
+}
+
+func (s *Server) handleOrderHistory(w http.ResponseWriter, r *http.Request, userId string) {
+	if s.authorize(w, r, userId) == nil {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	s.mu.Lock()
+	s.expireLocked(userId)
+	orders := []api.OrderRespData{}
+	// newest first, like Nebula
+	for i := len(s.orders[userId]) - 1; i >= 0; i-- {
+		o := s.orders[userId][i]
+		if status == "" || *o.Status == status {
+			orders = append(orders, o)
+		}
+	}
+	s.mu.Unlock()
+
+	start, end, paging := pageOf(r, len(orders))
+	writeJSON(w, http.StatusOK, map[string]any{"data": orders[start:end], "paging": paging})
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request, userId string, orderNo string) {
+	if s.authorize(w, r, userId) == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(userId)
+	for _, o := range s.orders[userId] {
+		if *o.OrderNo == orderNo {
+			writeJSON(w, http.StatusOK, o)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, api.ErrCodeNotFound, fmt.Sprintf("order [%s] does not exist", orderNo))
+}
+
+// pageOf reads offset and limit from the query and returns the bounds of the
+// page within total entries, with the link to the next page if there is one
+func pageOf(r *http.Request, total int) (int, int, map[string]string) {
+	q := r.URL.Query()
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit < total-offset {
+		end = offset + limit
+	}
+	paging := map[string]string{}
+	if end < total {
+		next := *r.URL
+		nq := next.Query()
+		nq.Set("offset", strconv.Itoa(end))
+		nq.Set("limit", strconv.Itoa(limit))
+		next.RawQuery = nq.Encode()
+		paging["next"] = next.RequestURI()
+	}
+	return offset, end, paging
+}
+
+func (s *Server) handleWallet(w http.ResponseWriter, r *http.Request, userId string, code string) {
+	acc := s.authorize(w, r, userId)
+	if acc == nil {
+		return
+	}
+
+	s.mu.Lock()
+	bal, ok := acc.Balances[code]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, api.ErrCodeWalletNotFound, fmt.Sprintf("wallet [%s] does not exist", code))
+		return
+	}
+
+	id := walletId(userId, code)
+	status := "ACTIVE"
+	sym := code
+	origin := "System"
+	info := []api.WalletLinkedData{{
+		Id:             &id,
+		Namespace:      &s.Namespace,
+		UserId:         &userId,
+		CurrencyCode:   &code,
+		CurrencySymbol: &sym,
+		Balance:        &bal,
+		BalanceOrigin:  &origin,
+		Status:         &status,
+	}}
+	writeJSON(w, http.StatusOK, api.WalletData{
+		Id:             &id,
+		Namespace:      &s.Namespace,
+		UserId:         &userId,
+		CurrencyCode:   &code,
+		CurrencySymbol: &sym,
+		Balance:        &bal,
+		WalletInfos:    &info,
+		WalletStatus:   &status,
+		Status:         &status,
+	})
+}
+
+func walletId(userId string, code string) string {
+	h := sha256.Sum256([]byte(userId + "/" + code))
+	return hex.EncodeToString(h[:16])
+}
+
+func (s *Server) handleCreateOrder(w http.ResponseWriter, r *http.Request, userId string) {
+	acc := s.authorize(w, r, userId)
+	if acc == nil {
+		return
+	}
+
+	var oid api.OrderInitData
+	if err := json.NewDecoder(r.Body).Decode(&oid); err != nil {
+		writeError(w, http.StatusBadRequest, api.ErrCodeValidation, "validation error")
+		return
+	}
+	if oid.Quantity <= 0 {
+		writeError(w, http.StatusBadRequest, api.ErrCodeValidation, "quantity must be positive")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var item *api.ShopItemData
+	for i := range s.items {
+		if s.items[i].ItemId != nil && *s.items[i].ItemId == oid.ItemId {
+			item = &s.items[i]
+			break
+		}
+	}
+	if item == nil {
+		writeError(w, http.StatusNotFound, api.ErrCodeItemNotFound, fmt.Sprintf("item [%s] does not exist in namespace [%s]", oid.ItemId, s.Namespace))
+		return
+	}
+	if item.Purchasable == nil || !*item.Purchasable || item.RegionData == nil || len(*item.RegionData) == 0 {
+		writeError(w, http.StatusConflict, api.ErrCodeItemNotPurchasable, fmt.Sprintf("item [%s] is not purchasable", oid.ItemId))
+		return
+	}
+
+	if item.MaxCount != nil && *item.MaxCount >= 0 && oid.Quantity > *item.MaxCount {
+		writeError(w, http.StatusConflict, api.ErrCodeMaxCount, fmt.Sprintf("item [%s] exceeds max count", oid.ItemId))
+		return
+	}
+	if item.MaxCountPerUser != nil && *item.MaxCountPerUser >= 0 && s.ownedLocked(userId, oid.ItemId)+oid.Quantity > *item.MaxCountPerUser {
+		writeError(w, http.StatusConflict, api.ErrCodeMaxCountPerUser, fmt.Sprintf("item [%s] exceeds max count per user", oid.ItemId))
+		return
+	}
+
+	var rd *api.ItemRegionData
+	for i, v := range *item.RegionData {
+		if v.CurrencyCode != nil && *v.CurrencyCode == oid.CurrencyCode {
+			rd = &(*item.RegionData)[i]
+			break
+		}
+	}
+	now := s.Now()
+	if rd != nil && !inWindow(now, rd.PurchaseAt, rd.ExpireAt) {
+		writeError(w, http.StatusConflict, api.ErrCodeItemNotPurchasable, fmt.Sprintf("item [%s] is not purchasable", oid.ItemId))
+		return
+	}
+	discounted := 0
+	if rd != nil {
+		discounted = *rd.DiscountedPrice
+		if !inWindow(now, rd.DiscountPurchaseAt, rd.DiscountExpireAt) {
+			discounted = *rd.Price
+		}
+	}
+	if rd == nil || *rd.Price*oid.Quantity != oid.Price || discounted*oid.Quantity != oid.DiscountedPrice {
+		writeError(w, http.StatusConflict, api.ErrCodePriceMismatch, "order price mismatch")
+		return
+	}
+
+	status := "FULFILLED"
+	var station *string
+	currencyType := "VIRTUAL"
+	if rd.CurrencyType != nil {
+		currencyType = *rd.CurrencyType
+	}
+	if currencyType == "REAL" {
+		// real money orders wait on the payment station
+		status = "INIT"
+	} else {
+		bal, ok := acc.Balances[oid.CurrencyCode]
+		if !ok || bal < oid.DiscountedPrice {
+			writeError(w, http.StatusBadRequest, api.ErrCodeInsufficientBalance, fmt.Sprintf("wallet [%s] has insufficient balance", walletId(userId, oid.CurrencyCode)))
+			return
+		}
+		acc.Balances[oid.CurrencyCode] = bal - oid.DiscountedPrice
+	}
+
+	s.seq++
+	now = now.UTC()
+	orderNo := fmt.Sprintf("O%s%06d", now.Format("20060102150405"), s.seq)
+	if status == "INIT" {
+		u := fmt.Sprintf("http://%s/payment/%s", r.Host, url.PathEscape(orderNo))
+		station = &u
+	}
+	decimals := 0
+	if currencyType == "REAL" {
+		decimals = 2
+	}
+	zero := 0
+	sandbox := false
+	expire := now.Add(10 * time.Minute)
+	remain := 600
+	snapshot := *item
+	order := api.OrderRespData{
+		OrderNo:            &orderNo,
+		PaymentOrderNo:     &orderNo,
+		Namespace:          &s.Namespace,
+		UserId:             &userId,
+		ItemId:             &oid.ItemId,
+		Sandbox:            &sandbox,
+		Quantity:           &oid.Quantity,
+		Price:              &oid.Price,
+		Tax:                &zero,
+		Vat:                &zero,
+		SalesTax:           &zero,
+		PaymentProviderFee: &zero,
+		PaymentMethodFee:   &zero,
+		Currency: &api.OrderCurrencyData{
+			CurrencyCode:   &oid.CurrencyCode,
+			CurrencySymbol: &oid.CurrencyCode,
+			CurrencyType:   &currencyType,
+			Namespace:      &s.Namespace,
+			Decimals:       &decimals,
+		},
+		PaymentStationUrl:    station,
+		ItemSnapshot:         &snapshot,
+		Region:               &oid.Region,
+		Language:             &oid.Language,
+		Status:               &status,
+		CreatedTime:          &now,
+		ExpireTime:           &expire,
+		PaymentRemainSeconds: &remain,
+		TotalTax:             &zero,
+		TotalPrice:           &oid.DiscountedPrice,
+		SubtotalPrice:        &oid.Price,
+		CreatedAt:            &now,
+		UpdatedAt:            &now,
+	}
+	s.orders[userId] = append(s.orders[userId], order)
+	if status == "FULFILLED" {
+		s.grantLocked(userId, *item, oid.Quantity)
+	}
+
+	writeJSON(w, http.StatusCreated, order)
+}
+
+// inWindow tells whether at falls between the optional bounds of a sale or discount
+func inWindow(at time.Time, from *time.Time, until *time.Time) bool {
+	return (from == nil || !at.Before(*from)) && (until == nil || at.Before(*until))
+}
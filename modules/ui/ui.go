@@ -6,6 +6,7 @@ Copyright (C) 2023  AlexDash
 package ui
 
 import (
+	"fmt"
 	"payshop3/api"
 
 	"golang.org/x/text/cases"
@@ -131,34 +132,101 @@ var LoaderUIBraile []string = []string{
 	"⠟",
 }
 
+// PrettifyBasic names the asset groups and their items. Items whose SKU does not
+// parse as an asset of the group are dropped; the catalog has already logged them.
 func PrettifyBasic(adg *[]api.AssetGroupData) *[]api.AssetGroupData {
 	var ret []api.AssetGroupData = []api.AssetGroupData{}
 	for _, v := range *adg {
-		pn := PrettyNamePrefixBySKU[v.Sku]
-		if pn == "" {
-			// No pretty name
-			pn = cases.Title(language.English).String(v.Sku)
-		}
+		pn := PrettyGroupName(v.Sku)
 		v.PrettyName = pn
 
-		item_bank := []api.ShopItemData{}
-		for _, x := range v.Bank {
-			ipn := PrettyNamesBySKU[*x.Sku]
-			if ipn == "" {
-				ipn = *x.Name
+		items := []api.Item{}
+		for _, x := range v.Items {
+			sku, err := api.ParseSKU(x.Sku)
+			if err != nil || sku.Group != v.Sku {
+				continue
 			}
-			x.PrettyName = &ipn
-			x.PrettyHeistName = &pn
-			item_bank = append(item_bank, x)
+			x.PrettyName = PrettyItemName(sku, x.Name)
+			x.PrettyHeistName = pn
+			items = append(items, x)
 		}
 
 		ret = append(ret, api.AssetGroupData{
 			GroupName:  cases.Title(language.English).String(v.Sku),
 			PrettyName: pn,
 			Sku:        v.Sku,
-			Bank:       item_bank,
+			Items:      items,
 		})
 
 	}
 	return &ret
 }
+
+// PrettyGroupName is the heist name of an asset group, or its SKU part in title case
+func PrettyGroupName(group string) string {
+	if pn := PrettyNamePrefixBySKU[group]; pn != "" {
+		return pn
+	}
+	// No pretty name
+	return cases.Title(language.English).String(group)
+}
+
+// PrettyItemName is the in-game name of an item, falling back to the catalog name
+// and then to the parts of its SKU
+func PrettyItemName(sku api.SKU, name string) string {
+	if pn := PrettyNamesBySKU[sku.Raw]; pn != "" {
+		return pn
+	}
+	if name != "" {
+		return name
+	}
+	if sku.Category == api.SkuPreplanning {
+		return fmt.Sprintf("%s asset %s", PrettyGroupName(sku.Group), sku.Variant)
+	}
+	return sku.Raw
+}
+
+// PrettifyInventory names the owned items like the shop does. Preplanning assets
+// get the heist they belong to; items whose SKU does not parse keep their name.
+func PrettifyInventory(inv []api.InventoryItem) []api.InventoryItem {
+	ret := make([]api.InventoryItem, 0, len(inv))
+	for _, v := range inv {
+		v.PrettyName = v.Name
+		if sku, err := api.ParseSKU(v.Sku); err == nil {
+			v.PrettyName = PrettyItemName(sku, v.Name)
+		} else if pn := PrettyNamesBySKU[v.Sku]; pn != "" {
+			v.PrettyName = pn
+		}
+		if v.Group != "" {
+			v.PrettyHeistName = PrettyGroupName(v.Group)
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// PrettySnapshotName names the item of an order from the snapshot taken when it was placed
+func PrettySnapshotName(d *api.ShopItemData) string {
+	if d == nil {
+		return "Unknown item"
+	}
+	name := ""
+	if d.Name != nil {
+		name = *d.Name
+	} else if d.Title != nil {
+		name = *d.Title
+	}
+	if d.Sku == nil {
+		return name
+	}
+	if sku, err := api.ParseSKU(*d.Sku); err == nil {
+		return PrettyItemName(sku, name)
+	}
+	if pn := PrettyNamesBySKU[*d.Sku]; pn != "" {
+		return pn
+	}
+	if name == "" {
+		return *d.Sku
+	}
+	return name
+}
@@ -0,0 +1,239 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"payshop3/api"
+	"payshop3/ui"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// orders shown per screen of the order history
+const orders_per_screen int = 20
+
+const order_date_layout string = "2006-01-02"
+
+// orderAmount formats an amount of the order currency, with its decimals and symbol
+func orderAmount(o api.OrderRespData, v *int) string {
+	if v == nil {
+		return "-"
+	}
+	cc, dec := "", 0
+	if o.Currency != nil {
+		if o.Currency.CurrencyCode != nil {
+			cc = *o.Currency.CurrencyCode
+		}
+		if o.Currency.Decimals != nil {
+			dec = *o.Currency.Decimals
+		}
+	}
+	amount := formatNumberSpaced(*v)
+	if dec > 0 {
+		amount = fmt.Sprintf("%.*f", dec, float64(*v)/math.Pow10(dec))
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s%s %s", ui.CurrencySumbolByCode[cc], amount, cc))
+}
+
+func orderCurrency(o api.OrderRespData) string {
+	if o.Currency == nil || o.Currency.CurrencyCode == nil {
+		return "-"
+	}
+	return *o.Currency.CurrencyCode
+}
+
+func orderTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func strVal(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
+
+func intVal(n *int) string {
+	if n == nil {
+		return "-"
+	}
+	return formatNumberSpaced(*n)
+}
+
+// orderDetails is the text of the detail view of an order
+func orderDetails(o api.OrderRespData) string {
+	lines := []string{
+		fmt.Sprintf("Order No: %s", strVal(o.OrderNo)),
+		fmt.Sprintf("Item: %s", ui.PrettySnapshotName(o.ItemSnapshot)),
+		fmt.Sprintf("Item ID: %s", strVal(o.ItemId)),
+		fmt.Sprintf("Quantity: %s", intVal(o.Quantity)),
+		fmt.Sprintf("Subtotal: %s", orderAmount(o, o.SubtotalPrice)),
+		fmt.Sprintf("Tax: %s", orderAmount(o, o.TotalTax)),
+		fmt.Sprintf("Total: %s", orderAmount(o, o.TotalPrice)),
+		fmt.Sprintf("Region: %s, language: %s", strVal(o.Region), strVal(o.Language)),
+		fmt.Sprintf("Status: %s", strVal(o.Status)),
+		fmt.Sprintf("Created: %s", orderTime(o.CreatedTime)),
+		fmt.Sprintf("Updated: %s", orderTime(o.UpdatedAt)),
+	}
+	if o.ItemSnapshot != nil && o.ItemSnapshot.Sku != nil {
+		lines = append(lines, fmt.Sprintf("SKU: %s", *o.ItemSnapshot.Sku))
+	}
+	if o.PaymentStationUrl != nil && o.Status != nil && *o.Status == "INIT" {
+		lines = append(lines, fmt.Sprintf("Payment link: %s", *o.PaymentStationUrl))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseOrderDate reads a date of the order filter; until includes the whole day
+func parseOrderDate(text string, until bool) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseInLocation(order_date_layout, text, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dates are written as YYYY-MM-DD, not %q", text)
+	}
+	if until {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d, nil
+}
+
+// showOrders opens the order history page and loads the orders in the background
+func showOrders() {
+	orders := []api.OrderRespData{}
+	screen := 0
+	statuses := append([]string{"Any"}, api.OrderStatuses...)
+
+	status := tview.NewTextView().SetTextAlign(tview.AlignCenter)
+	order_table := tview.NewTable().SetBorders(true).SetFixed(1, 0)
+	render := func() {
+		order_table.Clear()
+		for c, v := range []string{"Order No", "Item", "Qty", "Price", "Currency", "Status", "Time"} {
+			order_table.SetCell(0, c, tview.NewTableCell(v).SetAlign(tview.AlignCenter).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+		}
+		from := screen * orders_per_screen
+		to := from + orders_per_screen
+		if to > len(orders) {
+			to = len(orders)
+		}
+		for i, o := range orders[from:to] {
+			status_color := tcell.ColorOrange
+			if o.Status != nil && *o.Status == "FULFILLED" {
+				status_color = tcell.ColorGreen
+			}
+			order_table.SetCell(i+1, 0, tview.NewTableCell(strVal(o.OrderNo)).SetAlign(tview.AlignLeft))
+			order_table.SetCell(i+1, 1, tview.NewTableCell(ui.PrettySnapshotName(o.ItemSnapshot)).SetAlign(tview.AlignLeft))
+			order_table.SetCell(i+1, 2, tview.NewTableCell(intVal(o.Quantity)).SetAlign(tview.AlignRight))
+			order_table.SetCell(i+1, 3, tview.NewTableCell(orderAmount(o, o.TotalPrice)).SetAlign(tview.AlignRight))
+			order_table.SetCell(i+1, 4, tview.NewTableCell(orderCurrency(o)).SetAlign(tview.AlignLeft))
+			order_table.SetCell(i+1, 5, tview.NewTableCell(strVal(o.Status)).SetAlign(tview.AlignLeft).SetTextColor(status_color))
+			order_table.SetCell(i+1, 6, tview.NewTableCell(orderTime(o.CreatedTime)).SetAlign(tview.AlignLeft))
+		}
+		if len(orders) == 0 {
+			status.SetText("No orders found")
+			return
+		}
+		screens := (len(orders) + orders_per_screen - 1) / orders_per_screen
+		status.SetText(fmt.Sprintf("Orders %d-%d of %d, page %d of %d. Select an order for details", from+1, to, len(orders), screen+1, screens))
+	}
+
+	var filter_form *tview.Form
+	load := func() {
+		status_idx, _ := filter_form.GetFormItemByLabel("Status").(*tview.DropDown).GetCurrentOption()
+		f := api.OrderFilter{}
+		if status_idx > 0 {
+			f.Status = statuses[status_idx]
+		}
+		var err error
+		if f.From, err = parseOrderDate(filter_form.GetFormItemByLabel("From").(*tview.InputField).GetText(), false); err == nil {
+			f.Until, err = parseOrderDate(filter_form.GetFormItemByLabel("Until").(*tview.InputField).GetText(), true)
+		}
+		if err != nil {
+			status.SetText(fmt.Sprintf("Error: %s", err.Error()))
+			return
+		}
+		status.SetText("Loading orders...")
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			got, err := client.OrderHistory(ctx, f)
+			app.QueueUpdateDraw(func() {
+				if err != nil {
+					// the orders placed from this profile are better than nothing
+					local := loadHistory(activeProfile, f)
+					if len(local) == 0 {
+						status.SetText(fmt.Sprintf("Error: %s", err.Error()))
+						return
+					}
+					orders, screen = local, 0
+					render()
+					status.SetText(fmt.Sprintf("Error: %s. Showing the %d order(s) placed from this profile instead", err.Error(), len(local)))
+					return
+				}
+				orders, screen = got, 0
+				render()
+			})
+		}()
+	}
+
+	filter_form = tview.NewForm().SetHorizontal(true).
+		AddDropDown("Status", statuses, 0, nil).
+		AddInputField("From", "", 11, nil, nil).
+		AddInputField("Until", "", 11, nil, nil).
+		AddButton("Search", load).
+		AddButton("Prev", func() {
+			if screen > 0 {
+				screen--
+				render()
+			}
+		}).
+		AddButton("Next", func() {
+			if (screen+1)*orders_per_screen < len(orders) {
+				screen++
+				render()
+			}
+		}).
+		AddButton("Back", func() {
+			pages.SwitchToPage("entry")
+			app.SetFocus(main_menu_list)
+		})
+	filter_form.SetCancelFunc(func() {
+		pages.SwitchToPage("entry")
+		app.SetFocus(main_menu_list)
+	})
+
+	order_table.SetSelectable(true, false).SetSelectedFunc(func(row, column int) {
+		i := screen*orders_per_screen + row - 1
+		if row > 0 && i < len(orders) {
+			genericModal(orderDetails(orders[i]))
+		}
+	}).SetDoneFunc(func(key tcell.Key) {
+		app.SetFocus(filter_form)
+	})
+
+	orders_page := tview.NewGrid().
+		SetRows(1, 3, 0, 1).
+		SetBorders(true).
+		AddItem(newPrimitive("My Orders (dates as YYYY-MM-DD)"), 0, 0, 1, 1, 0, 0, false).
+		AddItem(filter_form, 1, 0, 1, 1, 0, 0, true).
+		AddItem(order_table, 2, 0, 1, 1, 0, 0, false).
+		AddItem(status, 3, 0, 1, 1, 0, 0, false)
+
+	pages.AddAndSwitchToPage("orders", orders_page, true)
+	app.SetFocus(filter_form)
+	load()
+}
@@ -0,0 +1,288 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"payshop3/api"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// Every profile is a directory holding its own login file, cart and order history
+const (
+	profiles_dir    string = "payshop3_profiles"
+	default_profile string = "default"
+	cart_file       string = "cart.json"
+	history_file    string = "history.jsonl"
+	new_profile_opt string = "+ New profile"
+)
+
+var (
+	// profile the current session belongs to, empty while logged out
+	activeProfile string
+	// profile preselected on the login screen
+	startProfile string
+	profile_name = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,31}$`)
+)
+
+// historyEntry is one line of the order history of a profile
+type historyEntry struct {
+	Time     time.Time `json:"time"`
+	OrderNo  string    `json:"order_no,omitempty"`
+	ItemId   string    `json:"item_id"`
+	Name     string    `json:"name,omitempty"`
+	Quantity int       `json:"quantity"`
+	Price    int       `json:"price"`
+	Currency string    `json:"currency"`
+	Status   string    `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func checkProfileName(name string) error {
+	if !profile_name.MatchString(name) {
+		return errors.New("profile names are 1-32 letters, digits, '.', '-' or '_'")
+	}
+	return nil
+}
+
+func profilePath(name string, file string) string {
+	return filepath.Join(profiles_dir, name, file)
+}
+
+// listProfiles returns the names of the profiles on disk, sorted
+func listProfiles() []string {
+	entries, err := os.ReadDir(profiles_dir)
+	if err != nil {
+		return []string{}
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() && checkProfileName(e.Name()) == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasSavedLogin(name string) bool {
+	_, err := os.Stat(profilePath(name, api.LoginFile))
+	return err == nil
+}
+
+// migrateLegacyLogin moves the login file of versions without profiles into the default profile
+func migrateLegacyLogin() {
+	if _, err := os.Stat(api.LoginFile); err != nil || hasSavedLogin(default_profile) {
+		return
+	}
+	if os.MkdirAll(filepath.Join(profiles_dir, default_profile), 0700) != nil {
+		return
+	}
+	os.Rename(api.LoginFile, profilePath(default_profile, api.LoginFile))
+}
+
+// prepareProfile creates the directory of a profile so its files can be saved
+func prepareProfile(name string) error {
+	if err := checkProfileName(name); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(profiles_dir, name), 0700)
+}
+
+// openProfile makes name the active profile once its session is up, and brings back its cart
+func openProfile(name string) {
+	activeProfile = name
+	Cart = loadCart(name)
+	// the prices and what the user owns may have changed since the cart was saved
+	repriceCart()
+	limitCart()
+	if settings.LastProfile != name {
+		settings.LastProfile = name
+		saveSettings(settings)
+	}
+}
+
+// closeProfile saves the cart of the active profile and leaves it
+func closeProfile() {
+	saveCart()
+	activeProfile = ""
+	Cart = []api.OrderInitData{}
+}
+
+func loadCart(name string) []api.OrderInitData {
+	c := []api.OrderInitData{}
+	raw, err := os.ReadFile(profilePath(name, cart_file))
+	if err != nil {
+		return c
+	}
+	if json.Unmarshal(raw, &c) != nil {
+		return []api.OrderInitData{}
+	}
+	// a hand-edited file must not break the cart table
+	lines := []api.OrderInitData{}
+	for _, v := range c {
+		if v.ItemId != "" && v.Quantity > 0 {
+			lines = append(lines, v)
+		}
+	}
+	return lines
+}
+
+// saveCart writes the cart of the active profile; a failure only goes to the log
+func saveCart() {
+	if activeProfile == "" {
+		return
+	}
+	raw, err := json.Marshal(Cart)
+	if err == nil {
+		err = api.WriteFileAtomic(profilePath(activeProfile, cart_file), raw)
+	}
+	if err != nil {
+		app_log.Printf("cart of profile %s not saved: %v", activeProfile, err)
+	}
+}
+
+func newHistoryEntry(item api.OrderInitData, od api.OrderRespData, err error) historyEntry {
+	e := historyEntry{
+		Time:     time.Now(),
+		ItemId:   item.ItemId,
+		Name:     item.PrettyName,
+		Quantity: item.Quantity,
+		Price:    item.DiscountedPrice,
+		Currency: item.CurrencyCode,
+	}
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	if od.OrderNo != nil {
+		e.OrderNo = *od.OrderNo
+	}
+	if od.Status != nil {
+		e.Status = *od.Status
+	}
+	return e
+}
+
+// appendHistory records an order attempt in the history of the active profile;
+// a failure only goes to the log
+func appendHistory(e historyEntry) {
+	if activeProfile == "" {
+		return
+	}
+	if err := writeHistory(profilePath(activeProfile, history_file), e); err != nil {
+		app_log.Printf("order history of profile %s not saved: %v", activeProfile, err)
+	}
+}
+
+func writeHistory(path string, e historyEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// histories of older versions were readable by everyone
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+	_, err = f.Write(append(raw, '\n'))
+	return err
+}
+
+// loadHistory turns the history of a profile into the orders it placed, newest
+// first and with the last status recorded, keeping the ones f lets through.
+// Attempts that placed no order are left out.
+func loadHistory(name string, f api.OrderFilter) []api.OrderRespData {
+	raw, err := os.ReadFile(profilePath(name, history_file))
+	if err != nil {
+		return []api.OrderRespData{}
+	}
+	seen := map[string]int{}
+	entries := []historyEntry{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		var e historyEntry
+		if json.Unmarshal([]byte(line), &e) != nil || e.OrderNo == "" || e.Error != "" {
+			continue
+		}
+		if i, ok := seen[e.OrderNo]; ok {
+			// a later status of an order followed until it settled
+			entries[i].Status = e.Status
+			continue
+		}
+		seen[e.OrderNo] = len(entries)
+		entries = append(entries, e)
+	}
+	orders := []api.OrderRespData{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if f.Status != "" && e.Status != f.Status {
+			continue
+		}
+		if (!f.From.IsZero() && e.Time.Before(f.From)) || (!f.Until.IsZero() && !e.Time.Before(f.Until)) {
+			continue
+		}
+		orders = append(orders, api.OrderRespData{
+			OrderNo:      &e.OrderNo,
+			ItemId:       &e.ItemId,
+			Quantity:     &e.Quantity,
+			TotalPrice:   &e.Price,
+			Currency:     &api.OrderCurrencyData{CurrencyCode: &e.Currency},
+			ItemSnapshot: &api.ShopItemData{Name: &e.Name},
+			Status:       &e.Status,
+			CreatedTime:  &e.Time,
+		})
+	}
+	return orders
+}
+
+// refreshProfilePicker reloads the profile dropdown of the login form and selects name
+func refreshProfilePicker(name string) {
+	opts := listProfiles()
+	idx := -1
+	for i, p := range opts {
+		if p == name {
+			idx = i
+		}
+	}
+	if idx < 0 && name != "" {
+		// picked with --profile but not created yet
+		opts = append(opts, name)
+		idx = len(opts) - 1
+	}
+	opts = append(opts, new_profile_opt)
+	if idx < 0 {
+		idx = len(opts) - 1
+	}
+	loginForm.GetFormItemByLabel("Profile").(*tview.DropDown).SetOptions(opts, nil).SetCurrentOption(idx)
+}
+
+// pickedProfile returns the profile chosen on the login form
+func pickedProfile() (string, error) {
+	_, name := loginForm.GetFormItemByLabel("Profile").(*tview.DropDown).GetCurrentOption()
+	if name == new_profile_opt {
+		name = loginForm.GetFormItemByLabel("New profile").(*tview.InputField).GetText()
+		if name == "" {
+			return "", errors.New("enter a name for the new profile")
+		}
+	}
+	if err := checkProfileName(name); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return name, nil
+}
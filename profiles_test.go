@@ -0,0 +1,111 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"os"
+	"payshop3/api"
+	"testing"
+	"time"
+)
+
+// inTempDir runs the test from an empty directory, where the profiles are kept
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestCheckProfileName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"default":                           true,
+		"alt.2":                             true,
+		"main_acc-":                         true,
+		"":                                  false,
+		".hidden":                           false,
+		"../up":                             false,
+		"a/b":                               false,
+		"waytoolongforaprofilename_1234567": false,
+	} {
+		if err := checkProfileName(name); (err == nil) != ok {
+			t.Errorf("checkProfileName(%q) = %v", name, err)
+		}
+	}
+}
+
+func TestCartKeptPerProfile(t *testing.T) {
+	inTempDir(t)
+	for _, name := range []string{"one", "two"} {
+		if err := prepareProfile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	activeProfile = "one"
+	Cart = []api.OrderInitData{{ItemId: "item", Quantity: 3, DiscountedPrice: 75000, CurrencyCode: "CASH"}}
+	t.Cleanup(func() {
+		activeProfile = ""
+		Cart = []api.OrderInitData{}
+	})
+	saveCart()
+	if fi, err := os.Stat(profilePath("one", cart_file)); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("cart file %v, want it private", err)
+	}
+
+	got := loadCart("one")
+	if len(got) != 1 || got[0].ItemId != "item" || got[0].Quantity != 3 {
+		t.Errorf("cart of one is %+v", got)
+	}
+	if got := loadCart("two"); len(got) != 0 {
+		t.Errorf("cart of two is %+v, want it empty", got)
+	}
+}
+
+func TestLoadHistory(t *testing.T) {
+	inTempDir(t)
+	if err := prepareProfile("one"); err != nil {
+		t.Fatal(err)
+	}
+	path := profilePath("one", history_file)
+	start := time.Now()
+	for _, e := range []historyEntry{
+		{Time: start, OrderNo: "O1", ItemId: "bag", Quantity: 1, Status: "FULFILLED"},
+		{Time: start.Add(time.Second), ItemId: "bag", Error: "insufficient balance"},
+		{Time: start.Add(2 * time.Second), OrderNo: "O2", ItemId: "credits", Quantity: 1, Status: "INIT"},
+		// O2 followed until it settled
+		{Time: start.Add(time.Minute), OrderNo: "O2", ItemId: "credits", Quantity: 1, Status: "FULFILLED"},
+	} {
+		if err := writeHistory(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("history file %v, want it private", err)
+	}
+
+	orders := loadHistory("one", api.OrderFilter{})
+	if len(orders) != 2 {
+		t.Fatalf("%d orders, want the 2 that were placed", len(orders))
+	}
+	if *orders[0].OrderNo != "O2" || *orders[0].Status != "FULFILLED" {
+		t.Errorf("first order %s %s, want O2 FULFILLED", *orders[0].OrderNo, *orders[0].Status)
+	}
+	if got := loadHistory("one", api.OrderFilter{Status: "INIT"}); len(got) != 0 {
+		t.Errorf("%d INIT orders, want none after O2 settled", len(got))
+	}
+	if got := loadHistory("one", api.OrderFilter{From: start.Add(time.Second)}); len(got) != 1 || *got[0].OrderNo != "O2" {
+		t.Errorf("orders from a second in: %d, want only O2", len(got))
+	}
+	if got := loadHistory("two", api.OrderFilter{}); len(got) != 0 {
+		t.Errorf("%d orders in a profile without history", len(got))
+	}
+}
@@ -0,0 +1,61 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"payshop3/api"
+)
+
+const (
+	settings_file string = "payshop3_settings.json"
+	// the TUI owns the terminal, so anything worth reporting goes here
+	log_file string = "payshop3.log"
+)
+
+type appSettings struct {
+	RateLimit   api.RateLimit `json:"rate_limit"`
+	LastProfile string        `json:"last_profile,omitempty"`
+}
+
+var settings appSettings
+
+// app_log is shared with the api client, set up by main
+var app_log *log.Logger = log.New(io.Discard, "", 0)
+
+// loadSettings reads the settings file, falling back to defaults for anything missing
+func loadSettings() appSettings {
+	s := appSettings{RateLimit: api.DefaultRateLimit}
+	raw, err := os.ReadFile(settings_file)
+	if err != nil {
+		return s
+	}
+	json.Unmarshal(raw, &s)
+	if s.RateLimit.Rate <= 0 {
+		s.RateLimit = api.DefaultRateLimit
+	}
+	return s
+}
+
+func saveSettings(s appSettings) error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(settings_file, raw, 0644)
+}
+
+// openLog appends to the log file, or discards everything if it cannot be opened
+func openLog() *log.Logger {
+	f, err := os.OpenFile(log_file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return log.New(io.Discard, "", 0)
+	}
+	return log.New(f, "", log.LstdFlags)
+}
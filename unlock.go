@@ -0,0 +1,83 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"fmt"
+	"payshop3/api"
+
+	"github.com/rivo/tview"
+)
+
+// unlockSavedLogin asks for the passphrase of the saved login of a profile before the main UI starts.
+// Plaintext files from older versions are encrypted with the chosen passphrase as soon
+// as they are read. ok is false when the user skipped the prompt.
+func unlockSavedLogin(profile string) (ld api.LoginData, store *api.EncryptedFileStore, ok bool) {
+	path := profilePath(profile, api.LoginFile)
+	encrypted, err := api.IsEncryptedLoginFile(path)
+	if err != nil {
+		return api.LoginData{}, nil, false
+	}
+
+	prompt := "Enter your passphrase to unlock the saved login"
+	if !encrypted {
+		prompt = "Your saved login is not encrypted.\nChoose a passphrase to protect it"
+	}
+
+	ta := tview.NewApplication()
+	var form *tview.Form
+	form = tview.NewForm().
+		AddTextView("Status", prompt, 50, 2, true, false).
+		AddPasswordField("Passphrase", "", 50, '*', nil).
+		AddButton("Unlock", func() {
+			status := form.GetFormItemByLabel("Status").(*tview.TextView)
+			pass := form.GetFormItemByLabel("Passphrase").(*tview.InputField).GetText()
+			if pass == "" {
+				status.SetText("Error: passphrase cannot be empty")
+				return
+			}
+			status.SetText("Unlocking...")
+			s, d, err := openSavedLogin(path, pass)
+			if err != nil {
+				status.SetText("Error: " + err.Error())
+				return
+			}
+			ld, store, ok = d, s, true
+			ta.Stop()
+		}).
+		AddButton("Skip", func() {
+			ta.Stop()
+		}).SetButtonsAlign(tview.AlignCenter)
+	form.SetBorder(true).SetTitle(fmt.Sprintf("Saved login - %s", profile)).SetTitleAlign(tview.AlignCenter)
+
+	screen := tview.NewGrid().SetColumns(0, 80, 0).SetRows(0, 11, 0).AddItem(form, 1, 1, 1, 1, 0, 0, true)
+	if err := ta.SetRoot(screen, true).SetFocus(form).EnableMouse(true).Run(); err != nil {
+		panic(err)
+	}
+	return ld, store, ok
+}
+
+// openSavedLogin reads a saved login with its passphrase, whether it is encrypted yet or not.
+// A plaintext login is written back encrypted right away, before anything else can fail.
+func openSavedLogin(path string, passphrase string) (*api.EncryptedFileStore, api.LoginData, error) {
+	s := api.NewEncryptedFileStore(path, passphrase)
+	encrypted, err := api.IsEncryptedLoginFile(path)
+	if err != nil {
+		return nil, api.LoginData{}, err
+	}
+	var d api.LoginData
+	if encrypted {
+		d, err = s.Load()
+		return s, d, err
+	}
+	if d, err = api.ReadPlainLoginFile(path); err != nil {
+		return nil, api.LoginData{}, err
+	}
+	if err := s.Save(d); err != nil {
+		return nil, api.LoginData{}, fmt.Errorf("could not encrypt the saved login: %w", err)
+	}
+	return s, d, nil
+}
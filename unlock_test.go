@@ -0,0 +1,39 @@
+/*
+PayShop3 - An Interactive Order-based System for PayDay3
+Source: https://github.com/Alex-Dash/payshop3
+Copyright (C) 2023  AlexDash
+*/
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"payshop3/api"
+	"testing"
+)
+
+func TestPlainLoginEncryptedOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), api.LoginFile)
+	raw, err := json.Marshal(api.LoginData{RefreshToken: "refresh", AutoLogin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, ld, err := openSavedLogin(path, "passphrase")
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if ld.RefreshToken != "refresh" {
+		t.Errorf("refresh token %q, want the saved one", ld.RefreshToken)
+	}
+	if encrypted, err := api.IsEncryptedLoginFile(path); err != nil || !encrypted {
+		t.Fatalf("the login file is still plaintext after the unlock: %v", err)
+	}
+	if ld, err = api.NewEncryptedFileStore(path, "passphrase").Load(); err != nil || ld.RefreshToken != "refresh" {
+		t.Errorf("the encrypted login reads %+v, %v", ld, err)
+	}
+}